@@ -2,11 +2,13 @@ package sources
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
 )
@@ -43,9 +45,38 @@ func HardCodedBuildFromGithub(ctx context.Context) (*spot.BuildImage, error) {
 		return nil, err
 	}
 
-	// TODO: Parse the metadata file and return the information inside the BuildImage
+	digest, err := digestFromMetadata(file.Name())
+	if err != nil {
+		return nil, err
+	}
+
 	return &spot.BuildImage{
 		URL:    fmt.Sprint(registry, ":", imageTag),
-		Digest: "TODO: digest from manifest",
+		Digest: digest,
 	}, nil
 }
+
+// buildctl writes the metadata of the build as a JSON object
+// once the image is pushed. The digest is the one of the manifest
+// that was pushed to the registry.
+type buildMetadata struct {
+	Digest string `json:"containerimage.digest"`
+}
+
+func digestFromMetadata(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var metadata buildMetadata
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return "", fmt.Errorf("couldn't parse the build metadata: %w", err)
+	}
+
+	if !strings.HasPrefix(metadata.Digest, "sha256:") {
+		return "", fmt.Errorf("the build metadata doesn't have a valid image digest: %q", metadata.Digest)
+	}
+
+	return metadata.Digest, nil
+}
@@ -0,0 +1,102 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	autoscaling "k8s.io/api/autoscaling/v2"
+	core "k8s.io/api/core/v1"
+)
+
+// Utilization of the CPU the autoscaler aims for when no target is set.
+const defaultTargetCPUUtilization = int32(80)
+
+// AutoscalingSpec scales the pods of a component between a minimum and a maximum
+// based on their average utilization. The utilization is a percentage of what the
+// pods request so the component's resources need to set the requests of the
+// targets, either directly or through the project's defaults.
+type AutoscalingSpec struct {
+	// Least number of pods running the component. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// Most number of pods running the component.
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// Average CPU utilization of the pods, in percent, the autoscaler aims for.
+	// Defaults to 80 when neither this nor the memory target is set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"`
+
+	// Average memory utilization of the pods, in percent, the autoscaler aims for.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilization *int32 `json:"targetMemoryUtilization,omitempty"`
+}
+
+// GetMinReplicas returns the least number of pods, defaulting to 1.
+func (a *AutoscalingSpec) GetMinReplicas() *int32 {
+	replicas := int32(1)
+	if a.MinReplicas != nil {
+		replicas = *a.MinReplicas
+	}
+
+	return &replicas
+}
+
+// Metrics returns the metrics of the HorizontalPodAutoscaler, one for every target.
+func (a *AutoscalingSpec) Metrics() []autoscaling.MetricSpec {
+	cpu := a.TargetCPUUtilization
+	if cpu == nil && a.TargetMemoryUtilization == nil {
+		utilization := defaultTargetCPUUtilization
+		cpu = &utilization
+	}
+
+	var metrics []autoscaling.MetricSpec
+	for _, target := range []struct {
+		name        core.ResourceName
+		utilization *int32
+	}{{core.ResourceCPU, cpu}, {core.ResourceMemory, a.TargetMemoryUtilization}} {
+		if target.utilization == nil {
+			continue
+		}
+
+		utilization := *target.utilization
+		metrics = append(metrics, autoscaling.MetricSpec{
+			Type: autoscaling.ResourceMetricSourceType,
+			Resource: &autoscaling.ResourceMetricSource{
+				Name: target.name,
+				Target: autoscaling.MetricTarget{
+					Type:               autoscaling.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		})
+	}
+
+	return metrics
+}
+
+// ValidateAutoscaling makes sure the bounds of the autoscaler make sense and that the
+// component doesn't set its replicas as well. Jobs run a single pod and can't scale.
+func (c *ComponentSpec) ValidateAutoscaling() error {
+	if c.Autoscaling == nil {
+		return nil
+	}
+
+	if c.IsJob() {
+		return fmt.Errorf("component %s is a job and can't autoscale", c.Name)
+	}
+
+	if c.Replicas != nil {
+		return fmt.Errorf("component %s autoscales and can't set its replicas", c.Name)
+	}
+
+	if min := *c.Autoscaling.GetMinReplicas(); min < 1 || c.Autoscaling.MaxReplicas < min {
+		return fmt.Errorf("component %s needs to autoscale between at least 1 pod and a maximum above the minimum, got %d to %d", c.Name, min, c.Autoscaling.MaxReplicas)
+	}
+
+	return nil
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -38,6 +40,22 @@ type BuildSpec struct {
 type BuildStatus struct {
 	Stage BuildStage `json:"stage"`
 
+	// ObservedGeneration is the generation of the build
+	// the status was last updated for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// StageTransitionTime is the last time the build moved to a different stage.
+	// +optional
+	StageTransitionTime *meta.Time `json:"stageTransitionTime,omitempty"`
+
+	// Conditions give more details about the build's stage.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []meta.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
 	// The Pod that will run the build logic
 	// It will be in charge of updating the status
 	// of this Build and store the BuildImage
@@ -55,6 +73,18 @@ type BuildImage struct {
 	URL    string `json:"url,omitempty"`
 }
 
+// Reference returns the image pinned to the digest that was pushed,
+// ie. `registry/image:tag@sha256:...`. The tag is kept for readability, the
+// digest is what the image resolves to. The URL is returned as is if
+// the digest is unknown.
+func (i BuildImage) Reference() string {
+	if len(i.Digest) == 0 {
+		return i.URL
+	}
+
+	return fmt.Sprintf("%s@%s", i.URL, i.Digest)
+}
+
 // +kubebuilder:validation:Enum=Running;Done;Errored
 type BuildStage string
 
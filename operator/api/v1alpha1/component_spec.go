@@ -2,29 +2,266 @@ package v1alpha1
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	core "k8s.io/api/core/v1"
 )
 
-var ErrComponentEnvSourceFound = errors.New("could not find a value for the specified environment name")
+var (
+	ErrComponentEnvSourceFound    = errors.New("could not find a value for the specified environment name")
+	ErrComponentDependencyCycle   = errors.New("components depend on each other")
+	ErrComponentUnknownDependency = errors.New("component depends on a component that doesn't exist")
+)
+
+// +kubebuilder:validation:Enum=Service;Job
+type ComponentKind string
+
+const (
+	// The component keeps running, ie. a web server or a database.
+	ComponentKindService ComponentKind = "Service"
+
+	// The component runs once to completion, ie. to migrate a database.
+	ComponentKindJob ComponentKind = "Job"
+)
 
 type ComponentSpec struct {
 	Name string `json:"name"`
 
+	// Kind of the component. A Job runs again every time the component
+	// changes, ie. when its image is rebuilt, and the components that depend
+	// on it are held until it succeeds. Defaults to Service.
+	// +optional
+	Kind ComponentKind `json:"kind,omitempty"`
+
 	// Execute a different entrypoint command than the one
 	// specified in the image
 	Command []string `json:"command,omitempty"`
 
 	// Links a component to an EnvironmentSpec entry.
-	Environments []ComponentEnvironmentSpec `json:"environments"`
+	Environments []ComponentEnvironmentSpec `json:"environments,omitempty"`
+
+	// Ports the component listens on. Every entry is exposed on the
+	// component's service. Components without services, like background
+	// workers, don't get a service.
+	// +optional
+	Services []ServiceSpec `json:"services,omitempty"`
+
+	// Number of pods running the component. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Autoscaling scales the number of pods with their utilization
+	// instead of running a fixed number of them.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// Names of the components that need to be ready before this
+	// component is started.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
 
-	// Network service
-	Services []ServiceSpec `json:"services"`
+	// Readiness tells when the component is ready to receive traffic. The
+	// components that depend on this one are held until it's ready. Defaults
+	// to a TCP check on the port of the first service.
+	// +optional
+	Readiness *ProbeSpec `json:"readiness,omitempty"`
+
+	// Liveness tells when the component needs to be restarted. There's
+	// no liveness check by default.
+	// +optional
+	Liveness *ProbeSpec `json:"liveness,omitempty"`
+
+	// Volumes persisted across the restarts of the component's pods.
+	// Components with volumes run a single replica and can't be autoscaled.
+	// +optional
+	Volumes []VolumeSpec `json:"volumes,omitempty"`
+
+	// Sidecars are containers running next to the component's
+	// container for as long as the component runs.
+	// +optional
+	Sidecars []ContainerSpec `json:"sidecars,omitempty"`
+
+	// InitContainers run to completion, in order, before the
+	// component's container and its sidecars start.
+	// +optional
+	InitContainers []ContainerSpec `json:"initContainers,omitempty"`
+
+	// Resources, scheduling and security settings of the component's
+	// pods. The ones that are not set fall back to the project's defaults.
+	RuntimeSpec `json:",inline"`
+
+	// Manifests deploys the component from a directory of
+	// manifests in the workspace's repository instead of an image.
+	// +optional
+	Manifests *ManifestsSpec `json:"manifests,omitempty"`
+
+	// Helm deploys the component from a Helm chart instead of an image.
+	// +optional
+	Helm *HelmSpec `json:"helm,omitempty"`
+
+	// Kustomize deploys the component from a kustomization in
+	// the workspace's repository instead of an image.
+	// +optional
+	Kustomize *KustomizeSpec `json:"kustomize,omitempty"`
 
 	// Defines how the image is built for this component
 	// The workspace will aggregate all the images at build time and
 	// will deduplicate the images so only 1 unique image is built.
-	Image ImageSpec `json:"image"`
+	// It's only optional for the components deployed from manifests.
+	// +optional
+	Image ImageSpec `json:"image,omitempty"`
+}
+
+// SortComponents orders the components so every component comes after the
+// components it depends on. Components without dependencies between them keep
+// their original order. An error is returned if a dependency doesn't exist or
+// if the dependencies form a cycle.
+func SortComponents(components []ComponentSpec) ([]ComponentSpec, error) {
+	indexes := make(map[string]int)
+	for i, component := range components {
+		indexes[component.Name] = i
+	}
+
+	for _, component := range components {
+		for _, dependency := range component.DependsOn {
+			if _, ok := indexes[dependency]; !ok {
+				return nil, fmt.Errorf("%w: %s depends on %s", ErrComponentUnknownDependency, component.Name, dependency)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(components))
+	sorted := make([]ComponentSpec, 0, len(components))
+
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		component := components[i]
+		path = append(path, component.Name)
+
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrComponentDependencyCycle, strings.Join(path, " -> "))
+		}
+
+		state[i] = visiting
+		for _, dependency := range component.DependsOn {
+			if err := visit(indexes[dependency], path); err != nil {
+				return err
+			}
+		}
+
+		state[i] = visited
+		sorted = append(sorted, component)
+		return nil
+	}
+
+	for i := range components {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// IsJob returns true when the component runs once to completion.
+func (c *ComponentSpec) IsJob() bool {
+	return c.Kind == ComponentKindJob
+}
+
+// ValidateKind makes sure the settings of the component make sense for its
+// kind. Jobs don't receive any traffic and run a single pod.
+func (c *ComponentSpec) ValidateKind() error {
+	if !c.IsJob() {
+		return nil
+	}
+
+	if len(c.Services) != 0 {
+		return fmt.Errorf("component %s is a job and can't have services", c.Name)
+	}
+
+	if c.Replicas != nil {
+		return fmt.Errorf("component %s is a job and can't set its replicas", c.Name)
+	}
+
+	return nil
+}
+
+// GetReplicas returns the number of pods for the component, defaulting to 1.
+// Autoscaled components return the least number of pods they run.
+func (c *ComponentSpec) GetReplicas() *int32 {
+	if c.Autoscaling != nil {
+		return c.Autoscaling.GetMinReplicas()
+	}
+
+	replicas := int32(1)
+	if c.Replicas != nil {
+		replicas = *c.Replicas
+	}
+
+	return &replicas
+}
+
+// ReadinessProbe returns the probe for the readiness of the component, falling
+// back to a TCP check on the first service served over TCP. Components without
+// such a service don't have a readiness check by default.
+func (c *ComponentSpec) ReadinessProbe() *core.Probe {
+	if c.Readiness != nil {
+		return c.Readiness.Probe()
+	}
+
+	for _, service := range c.Services {
+		if protocol, _, err := service.TransportProtocol(); err == nil && protocol == core.ProtocolTCP {
+			probe := &ProbeSpec{TCP: &TCPProbeSpec{Port: service.Port}}
+			return probe.Probe()
+		}
+	}
+
+	return nil
+}
+
+// ValidateServices makes sure every service has a valid port and protocol and
+// that the names of the ports are unique, including the ports of the sidecars.
+func (c *ComponentSpec) ValidateServices() error {
+	names := make(map[string]bool)
+
+	for _, service := range c.AllServices() {
+		if service.Port < 1 || service.Port > 65535 {
+			return fmt.Errorf("component %s has an invalid port: %d", c.Name, service.Port)
+		}
+
+		if _, _, err := service.TransportProtocol(); err != nil {
+			return fmt.Errorf("component %s: %w", c.Name, err)
+		}
+
+		name := service.PortName()
+		if names[name] {
+			return fmt.Errorf("component %s has more than one port named %s", c.Name, name)
+		}
+
+		names[name] = true
+	}
+
+	return nil
+}
+
+// LivenessProbe returns the probe for the liveness of the component, if any.
+func (c *ComponentSpec) LivenessProbe() *core.Probe {
+	if c.Liveness == nil {
+		return nil
+	}
+
+	return c.Liveness.Probe()
 }
 
 func (c *ComponentSpec) GetEnvVars() []core.EnvVar {
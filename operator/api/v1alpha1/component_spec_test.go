@@ -0,0 +1,382 @@
+package v1alpha1
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSortComponents(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []ComponentSpec
+		want       []string
+		err        error
+	}{
+		{
+			name:       "no dependencies keep their order",
+			components: []ComponentSpec{{Name: "web"}, {Name: "worker"}, {Name: "db"}},
+			want:       []string{"web", "worker", "db"},
+		},
+		{
+			name: "dependencies come first",
+			components: []ComponentSpec{
+				{Name: "web", DependsOn: []string{"api"}},
+				{Name: "api", DependsOn: []string{"db", "cache"}},
+				{Name: "db"},
+				{Name: "cache"},
+			},
+			want: []string{"db", "cache", "api", "web"},
+		},
+		{
+			name: "shared dependency",
+			components: []ComponentSpec{
+				{Name: "web", DependsOn: []string{"db"}},
+				{Name: "worker", DependsOn: []string{"db"}},
+				{Name: "db"},
+			},
+			want: []string{"db", "web", "worker"},
+		},
+		{
+			name:       "unknown dependency",
+			components: []ComponentSpec{{Name: "web", DependsOn: []string{"db"}}},
+			err:        ErrComponentUnknownDependency,
+		},
+		{
+			name: "cycle",
+			components: []ComponentSpec{
+				{Name: "web", DependsOn: []string{"api"}},
+				{Name: "api", DependsOn: []string{"web"}},
+			},
+			err: ErrComponentDependencyCycle,
+		},
+		{
+			name:       "depends on itself",
+			components: []ComponentSpec{{Name: "web", DependsOn: []string{"web"}}},
+			err:        ErrComponentDependencyCycle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := SortComponents(tt.components)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, component := range sorted {
+				got = append(got, component.Name)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentSpecValidate(t *testing.T) {
+	replicas := func(n int32) *int32 { return &n }
+	image := ImageSpec{Name: "nginx"}
+
+	tests := []struct {
+		name      string
+		component ComponentSpec
+		validate  func(*ComponentSpec) error
+		err       bool
+	}{
+		{
+			name:      "services",
+			component: ComponentSpec{Name: "web", Services: []ServiceSpec{{Port: 80}, {Port: 443, Protocol: "https"}}},
+			validate:  (*ComponentSpec).ValidateServices,
+		},
+		{
+			name:      "service with an invalid port",
+			component: ComponentSpec{Name: "web", Services: []ServiceSpec{{Port: 70000}}},
+			validate:  (*ComponentSpec).ValidateServices,
+			err:       true,
+		},
+		{
+			name:      "service with an unknown protocol",
+			component: ComponentSpec{Name: "web", Services: []ServiceSpec{{Port: 80, Protocol: "smtp"}}},
+			validate:  (*ComponentSpec).ValidateServices,
+			err:       true,
+		},
+		{
+			name: "sidecar reusing a port name",
+			component: ComponentSpec{
+				Name:     "web",
+				Services: []ServiceSpec{{Port: 80}},
+				Sidecars: []ContainerSpec{{Name: "proxy", Image: image, Services: []ServiceSpec{{Port: 80}}}},
+			},
+			validate: (*ComponentSpec).ValidateServices,
+			err:      true,
+		},
+		{
+			name:      "job",
+			component: ComponentSpec{Name: "migrate", Kind: ComponentKindJob},
+			validate:  (*ComponentSpec).ValidateKind,
+		},
+		{
+			name:      "job with services",
+			component: ComponentSpec{Name: "migrate", Kind: ComponentKindJob, Services: []ServiceSpec{{Port: 80}}},
+			validate:  (*ComponentSpec).ValidateKind,
+			err:       true,
+		},
+		{
+			name:      "job with replicas",
+			component: ComponentSpec{Name: "migrate", Kind: ComponentKindJob, Replicas: replicas(2)},
+			validate:  (*ComponentSpec).ValidateKind,
+			err:       true,
+		},
+		{
+			name:      "autoscaling",
+			component: ComponentSpec{Name: "web", Autoscaling: &AutoscalingSpec{MinReplicas: replicas(2), MaxReplicas: 4}},
+			validate:  (*ComponentSpec).ValidateAutoscaling,
+		},
+		{
+			name:      "autoscaling with replicas",
+			component: ComponentSpec{Name: "web", Replicas: replicas(2), Autoscaling: &AutoscalingSpec{MaxReplicas: 4}},
+			validate:  (*ComponentSpec).ValidateAutoscaling,
+			err:       true,
+		},
+		{
+			name:      "autoscaling below its minimum",
+			component: ComponentSpec{Name: "web", Autoscaling: &AutoscalingSpec{MinReplicas: replicas(3), MaxReplicas: 2}},
+			validate:  (*ComponentSpec).ValidateAutoscaling,
+			err:       true,
+		},
+		{
+			name:      "autoscaling job",
+			component: ComponentSpec{Name: "migrate", Kind: ComponentKindJob, Autoscaling: &AutoscalingSpec{MaxReplicas: 2}},
+			validate:  (*ComponentSpec).ValidateAutoscaling,
+			err:       true,
+		},
+		{
+			name: "volumes",
+			component: ComponentSpec{Name: "db", Volumes: []VolumeSpec{
+				{Name: "data", Size: resource.MustParse("1Gi"), MountPath: "/var/lib/data"},
+				{Name: "logs", Size: resource.MustParse("1Gi"), MountPath: "/var/log"},
+			}},
+			validate: (*ComponentSpec).ValidateVolumes,
+		},
+		{
+			name:      "volume with an invalid name",
+			component: ComponentSpec{Name: "db", Volumes: []VolumeSpec{{Name: "Data", Size: resource.MustParse("1Gi"), MountPath: "/data"}}},
+			validate:  (*ComponentSpec).ValidateVolumes,
+			err:       true,
+		},
+		{
+			name:      "volume without a size",
+			component: ComponentSpec{Name: "db", Volumes: []VolumeSpec{{Name: "data", MountPath: "/data"}}},
+			validate:  (*ComponentSpec).ValidateVolumes,
+			err:       true,
+		},
+		{
+			name:      "volume with a relative mount path",
+			component: ComponentSpec{Name: "db", Volumes: []VolumeSpec{{Name: "data", Size: resource.MustParse("1Gi"), MountPath: "data"}}},
+			validate:  (*ComponentSpec).ValidateVolumes,
+			err:       true,
+		},
+		{
+			name: "volumes mounted at the same path",
+			component: ComponentSpec{Name: "db", Volumes: []VolumeSpec{
+				{Name: "data", Size: resource.MustParse("1Gi"), MountPath: "/data"},
+				{Name: "other", Size: resource.MustParse("1Gi"), MountPath: "/data/"},
+			}},
+			validate: (*ComponentSpec).ValidateVolumes,
+			err:      true,
+		},
+		{
+			name:      "volumes with a single replica",
+			component: ComponentSpec{Name: "db", Replicas: replicas(1), Volumes: []VolumeSpec{{Name: "data", Size: resource.MustParse("1Gi"), MountPath: "/data"}}},
+			validate:  (*ComponentSpec).ValidateVolumes,
+		},
+		{
+			name:      "volumes with replicas",
+			component: ComponentSpec{Name: "db", Replicas: replicas(2), Volumes: []VolumeSpec{{Name: "data", Size: resource.MustParse("1Gi"), MountPath: "/data"}}},
+			validate:  (*ComponentSpec).ValidateVolumes,
+			err:       true,
+		},
+		{
+			name:      "autoscaled volumes",
+			component: ComponentSpec{Name: "db", Autoscaling: &AutoscalingSpec{MaxReplicas: 2}, Volumes: []VolumeSpec{{Name: "data", Size: resource.MustParse("1Gi"), MountPath: "/data"}}},
+			validate:  (*ComponentSpec).ValidateVolumes,
+			err:       true,
+		},
+		{
+			name: "containers",
+			component: ComponentSpec{
+				Name:           "web",
+				Sidecars:       []ContainerSpec{{Name: "proxy", Image: image, Services: []ServiceSpec{{Port: 8080}}}},
+				InitContainers: []ContainerSpec{{Name: "assets", Image: image}},
+			},
+			validate: (*ComponentSpec).ValidateContainers,
+		},
+		{
+			name:      "container named after the component",
+			component: ComponentSpec{Name: "web", Sidecars: []ContainerSpec{{Name: "web", Image: image}}},
+			validate:  (*ComponentSpec).ValidateContainers,
+			err:       true,
+		},
+		{
+			name:      "container without an image",
+			component: ComponentSpec{Name: "web", Sidecars: []ContainerSpec{{Name: "proxy"}}},
+			validate:  (*ComponentSpec).ValidateContainers,
+			err:       true,
+		},
+		{
+			name:      "init container with services",
+			component: ComponentSpec{Name: "web", InitContainers: []ContainerSpec{{Name: "assets", Image: image, Services: []ServiceSpec{{Port: 80}}}}},
+			validate:  (*ComponentSpec).ValidateContainers,
+			err:       true,
+		},
+		{
+			name:      "job with sidecars",
+			component: ComponentSpec{Name: "migrate", Kind: ComponentKindJob, Sidecars: []ContainerSpec{{Name: "proxy", Image: image}}},
+			validate:  (*ComponentSpec).ValidateContainers,
+			err:       true,
+		},
+		{
+			name:      "image",
+			component: ComponentSpec{Name: "web", Image: image},
+			validate:  (*ComponentSpec).ValidateDeployer,
+		},
+		{
+			name:      "without an image",
+			component: ComponentSpec{Name: "web"},
+			validate:  (*ComponentSpec).ValidateDeployer,
+			err:       true,
+		},
+		{
+			name:      "manifests",
+			component: ComponentSpec{Name: "web", Manifests: &ManifestsSpec{Path: "deploy/web"}},
+			validate:  (*ComponentSpec).ValidateDeployer,
+		},
+		{
+			name:      "manifests outside of the repository",
+			component: ComponentSpec{Name: "web", Manifests: &ManifestsSpec{Path: "../deploy"}},
+			validate:  (*ComponentSpec).ValidateDeployer,
+			err:       true,
+		},
+		{
+			name:      "manifests and helm",
+			component: ComponentSpec{Name: "web", Manifests: &ManifestsSpec{Path: "deploy"}, Helm: &HelmSpec{Path: "chart"}},
+			validate:  (*ComponentSpec).ValidateDeployer,
+			err:       true,
+		},
+		{
+			name:      "manifests with replicas",
+			component: ComponentSpec{Name: "web", Kustomize: &KustomizeSpec{Path: "deploy"}, Replicas: replicas(2)},
+			validate:  (*ComponentSpec).ValidateDeployer,
+			err:       true,
+		},
+		{
+			name:      "chart repository",
+			component: ComponentSpec{Name: "redis", Helm: &HelmSpec{Repository: "https://charts.bitnami.com/bitnami", Chart: "redis"}},
+			validate:  (*ComponentSpec).ValidateDeployer,
+		},
+		{
+			name:      "chart repository over http",
+			component: ComponentSpec{Name: "redis", Helm: &HelmSpec{Repository: "http://charts.bitnami.com/bitnami", Chart: "redis"}},
+			validate:  (*ComponentSpec).ValidateDeployer,
+			err:       true,
+		},
+		{
+			name:      "chart repository without a chart",
+			component: ComponentSpec{Name: "redis", Helm: &HelmSpec{Repository: "https://charts.bitnami.com/bitnami"}},
+			validate:  (*ComponentSpec).ValidateDeployer,
+			err:       true,
+		},
+		{
+			name: "probes",
+			component: ComponentSpec{
+				Name:      "web",
+				Readiness: &ProbeSpec{HTTP: &HTTPProbeSpec{Path: "/health", Port: 80}},
+				Liveness:  &ProbeSpec{Exec: &ExecProbeSpec{Command: []string{"true"}}},
+			},
+			validate: (*ComponentSpec).ValidateProbes,
+		},
+		{
+			name:      "probe with two checks",
+			component: ComponentSpec{Name: "web", Readiness: &ProbeSpec{HTTP: &HTTPProbeSpec{Port: 80}, TCP: &TCPProbeSpec{Port: 80}}},
+			validate:  (*ComponentSpec).ValidateProbes,
+			err:       true,
+		},
+		{
+			name:      "probe without a check",
+			component: ComponentSpec{Name: "web", Liveness: &ProbeSpec{PeriodSeconds: 10}},
+			validate:  (*ComponentSpec).ValidateProbes,
+			err:       true,
+		},
+		{
+			name:      "probe with an invalid port",
+			component: ComponentSpec{Name: "web", Readiness: &ProbeSpec{TCP: &TCPProbeSpec{}}},
+			validate:  (*ComponentSpec).ValidateProbes,
+			err:       true,
+		},
+		{
+			name:      "probe with an empty command",
+			component: ComponentSpec{Name: "web", Liveness: &ProbeSpec{Exec: &ExecProbeSpec{}}},
+			validate:  (*ComponentSpec).ValidateProbes,
+			err:       true,
+		},
+		{
+			name:      "probe with a negative period",
+			component: ComponentSpec{Name: "web", Readiness: &ProbeSpec{TCP: &TCPProbeSpec{Port: 80}, PeriodSeconds: -1}},
+			validate:  (*ComponentSpec).ValidateProbes,
+			err:       true,
+		},
+		{
+			name: "resources",
+			component: ComponentSpec{Name: "web", RuntimeSpec: RuntimeSpec{Resources: &core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceCPU: resource.MustParse("100m")},
+				Limits:   core.ResourceList{core.ResourceCPU: resource.MustParse("1")},
+			}}},
+			validate: (*ComponentSpec).ValidateRuntime,
+		},
+		{
+			name: "request above its limit",
+			component: ComponentSpec{Name: "web", RuntimeSpec: RuntimeSpec{Resources: &core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceMemory: resource.MustParse("1Gi")},
+				Limits:   core.ResourceList{core.ResourceMemory: resource.MustParse("512Mi")},
+			}}},
+			validate: (*ComponentSpec).ValidateRuntime,
+			err:      true,
+		},
+		{
+			name: "container request above its limit",
+			component: ComponentSpec{Name: "web", Sidecars: []ContainerSpec{{Name: "proxy", Image: image, Resources: &core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceCPU: resource.MustParse("2")},
+				Limits:   core.ResourceList{core.ResourceCPU: resource.MustParse("1")},
+			}}}},
+			validate: (*ComponentSpec).ValidateRuntime,
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validate(&tt.component)
+			if tt.err && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types set on a Workspace.
+const (
+	// All the builds for the workspace completed successfully.
+	WorkspaceConditionBuildsSucceeded = "BuildsSucceeded"
+
+	// All the components of the workspace are deployed.
+	WorkspaceConditionDeployed = "Deployed"
+
+	// The workspace is running and its status reflects its current spec.
+	WorkspaceConditionReady = "Ready"
+
+	// The workspace hit an error and can't move forward on its own.
+	WorkspaceConditionDegraded = "Degraded"
+)
+
+// Condition types set on a Build.
+const (
+	// The image was built and pushed to its registry.
+	BuildConditionSucceeded = "Succeeded"
+)
+
+// Reasons used by the conditions. The stages are also
+// used as reasons.
+const (
+	ReasonBuildsPending         = "BuildsPending"
+	ReasonBuildFailed           = "BuildFailed"
+	ReasonBuildsDone            = "BuildsDone"
+	ReasonDeployPending         = "DeployPending"
+	ReasonWaitingOnDependencies = "WaitingOnDependencies"
+	ReasonComponentsNotReady    = "ComponentsNotReady"
+	ReasonDeployed              = "Deployed"
+	ReasonNoError               = "NoError"
+)
+
+// SetStage moves the workspace to the stage and records when the transition happened. The
+// Ready and Degraded conditions are kept in sync with the stage, the message is used for both
+// of them and is generally only relevant for the Errored stage.
+//
+// The stage the workspace was in is recorded as the failed stage when it
+// moves to the Errored stage so it can be retried from there.
+func (w *Workspace) SetStage(stage WorkspaceStage, message string) {
+	if w.Status.Stage != stage || w.Status.StageTransitionTime == nil {
+		now := metav1.Now()
+		w.Status.StageTransitionTime = &now
+	}
+
+	if stage == WorkspaceStageError && w.Status.Stage != WorkspaceStageError {
+		w.Status.FailedStage = w.Status.Stage
+	}
+
+	w.Status.Stage = stage
+
+	ready := metav1.ConditionFalse
+	if stage == WorkspaceStageRunning {
+		ready = metav1.ConditionTrue
+	}
+
+	w.SetCondition(WorkspaceConditionReady, ready, stageReason(string(stage)), message)
+
+	if stage == WorkspaceStageError {
+		w.SetCondition(WorkspaceConditionDegraded, metav1.ConditionTrue, string(stage), message)
+	} else {
+		w.SetCondition(WorkspaceConditionDegraded, metav1.ConditionFalse, ReasonNoError, "")
+	}
+}
+
+// SetCondition adds or updates the condition on the workspace's status.
+func (w *Workspace) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&w.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: w.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// SetStage moves the build to the stage and records when the transition happened. The
+// Succeeded condition is kept in sync with the stage.
+func (b *Build) SetStage(stage BuildStage, message string) {
+	if b.Status.Stage != stage || b.Status.StageTransitionTime == nil {
+		now := metav1.Now()
+		b.Status.StageTransitionTime = &now
+	}
+
+	b.Status.Stage = stage
+	b.Status.ObservedGeneration = b.Generation
+
+	status := metav1.ConditionUnknown
+	switch stage {
+	case BuildStageDone:
+		status = metav1.ConditionTrue
+	case BuildStageError:
+		status = metav1.ConditionFalse
+	}
+
+	meta.SetStatusCondition(&b.Status.Conditions, metav1.Condition{
+		Type:               BuildConditionSucceeded,
+		Status:             status,
+		ObservedGeneration: b.Generation,
+		Reason:             stageReason(string(stage)),
+		Message:            message,
+	})
+}
+
+// Reasons can't be empty, the initialized stages
+// are the only one without a value.
+func stageReason(stage string) string {
+	if len(stage) == 0 {
+		return "Initialized"
+	}
+
+	return stage
+}
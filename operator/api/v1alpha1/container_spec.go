@@ -0,0 +1,100 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ContainerSpec is an additional container in the pods of a component, ie. a
+// proxy to a database running next to the component or a step compiling
+// the assets before the component starts.
+type ContainerSpec struct {
+	// Name of the container, unique within the component.
+	Name string `json:"name"`
+
+	// Image of the container. Like the component's image, it's built
+	// from the workspace's repository when `repository_context` is set.
+	Image ImageSpec `json:"image"`
+
+	// Execute a different entrypoint command than the one
+	// specified in the image
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// Links the container to EnvironmentSpec entries.
+	// +optional
+	Environments []ComponentEnvironmentSpec `json:"environments,omitempty"`
+
+	// Ports the container listens on. They are exposed on the
+	// component's service along with the component's ports.
+	// +optional
+	Services []ServiceSpec `json:"services,omitempty"`
+
+	// Resources requested by the container and its limits.
+	// +optional
+	Resources *core.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// AllServices returns the ports of the component followed by the
+// ports of its sidecars. They are all exposed on the component's service.
+func (c *ComponentSpec) AllServices() []ServiceSpec {
+	services := append([]ServiceSpec{}, c.Services...)
+	for _, sidecar := range c.Sidecars {
+		services = append(services, sidecar.Services...)
+	}
+
+	return services
+}
+
+// Images returns the image of the component followed by
+// the images of its sidecars and init containers.
+func (c *ComponentSpec) Images() []ImageSpec {
+	images := []ImageSpec{c.Image}
+	for _, container := range c.Containers() {
+		images = append(images, container.Image)
+	}
+
+	return images
+}
+
+// Containers returns the sidecars of the component
+// followed by its init containers.
+func (c *ComponentSpec) Containers() []ContainerSpec {
+	return append(append([]ContainerSpec{}, c.Sidecars...), c.InitContainers...)
+}
+
+// ValidateContainers makes sure the additional containers have unique names, an
+// image, and that only the sidecars listen on ports. Jobs can't have sidecars as
+// they keep running and the job would never complete.
+func (c *ComponentSpec) ValidateContainers() error {
+	if c.IsJob() && len(c.Sidecars) != 0 {
+		return fmt.Errorf("component %s is a job and can't have sidecars", c.Name)
+	}
+
+	names := map[string]bool{c.Name: true}
+	for _, container := range c.Containers() {
+		if errs := validation.IsDNS1123Label(container.Name); len(errs) != 0 {
+			return fmt.Errorf("component %s has a container with an invalid name %q: %s", c.Name, container.Name, errs[0])
+		}
+
+		if names[container.Name] {
+			return fmt.Errorf("component %s has more than one container named %s", c.Name, container.Name)
+		}
+
+		if len(container.Image.Name) == 0 {
+			return fmt.Errorf("container %s of component %s doesn't have an image", container.Name, c.Name)
+		}
+
+		names[container.Name] = true
+	}
+
+	for _, container := range c.InitContainers {
+		if len(container.Services) != 0 {
+			return fmt.Errorf("init container %s of component %s can't have services", container.Name, c.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// ManifestsSpec deploys the component from a directory of manifests in
+// the workspace's repository. Every `.yaml`, `.yml` and `.json` file of the
+// directory and its subdirectories is applied.
+type ManifestsSpec struct {
+	// Path of the directory within the repository.
+	Path string `json:"path"`
+}
+
+// HelmSpec deploys the component from a Helm chart, either stored in the workspace's
+// repository or fetched from a chart repository. The chart is rendered by the operator
+// and the objects are applied like any other component, the release isn't recorded
+// and the hooks of the chart are not run.
+type HelmSpec struct {
+	// Path of the chart within the workspace's repository.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// URL of the chart repository the chart is fetched from when
+	// `path` isn't set, ie. "https://charts.bitnami.com/bitnami".
+	// +optional
+	Repository string `json:"repository,omitempty"`
+
+	// Name of the chart in the chart repository.
+	// +optional
+	Chart string `json:"chart,omitempty"`
+
+	// Version of the chart in the chart repository. Defaults to the latest version.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Values passed to the chart. Strings can reference the workspace with
+	// the placeholders `{{workspace}}`, `{{namespace}}`, `{{image}}`,
+	// `{{image.repository}}`, `{{image.tag}}`, `{{image.digest}}` and
+	// `{{env:NAME}}` where NAME is one of the component's environments.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Values *apiextensions.JSON `json:"values,omitempty"`
+}
+
+// KustomizeSpec deploys the component from a kustomization in the workspace's repository.
+type KustomizeSpec struct {
+	// Path of the directory holding the `kustomization.yaml` within the repository.
+	Path string `json:"path"`
+}
+
+// Deployer returns how the component is deployed: "manifests", "helm",
+// "kustomize" or "image" for the components running an image.
+func (c *ComponentSpec) Deployer() string {
+	switch {
+	case c.Manifests != nil:
+		return "manifests"
+	case c.Helm != nil:
+		return "helm"
+	case c.Kustomize != nil:
+		return "kustomize"
+	default:
+		return "image"
+	}
+}
+
+// FromRepository returns true when the objects of the component
+// are rendered from the workspace's repository.
+func (c *ComponentSpec) FromRepository() bool {
+	return len(c.RepositoryPath()) != 0
+}
+
+// RepositoryPath returns the path of the component's manifests, chart or
+// kustomization within the repository. It's empty for the other components.
+func (c *ComponentSpec) RepositoryPath() string {
+	switch {
+	case c.Manifests != nil:
+		return c.Manifests.Path
+	case c.Kustomize != nil:
+		return c.Kustomize.Path
+	case c.Helm != nil:
+		return c.Helm.Path
+	default:
+		return ""
+	}
+}
+
+// ValidateDeployer makes sure the component is deployed in a single way and
+// that the components rendered from manifests don't set any of the settings
+// that only apply to the components running an image. Their image is
+// optional, it's built and passed to the manifests when it's set.
+func (c *ComponentSpec) ValidateDeployer() error {
+	deployers := 0
+	for _, set := range []bool{c.Manifests != nil, c.Helm != nil, c.Kustomize != nil} {
+		if set {
+			deployers++
+		}
+	}
+
+	if deployers > 1 {
+		return fmt.Errorf("component %s can only set one of manifests, helm and kustomize", c.Name)
+	}
+
+	deployer := c.Deployer()
+	if deployer == "image" {
+		if len(c.Image.Name) == 0 {
+			return fmt.Errorf("component %s doesn't have an image", c.Name)
+		}
+
+		return nil
+	}
+
+	unsupported := []struct {
+		field string
+		set   bool
+	}{
+		{"kind", c.IsJob()},
+		{"command", len(c.Command) != 0},
+		{"services", len(c.Services) != 0},
+		{"replicas", c.Replicas != nil},
+		{"autoscaling", c.Autoscaling != nil},
+		{"readiness", c.Readiness != nil},
+		{"liveness", c.Liveness != nil},
+		{"volumes", len(c.Volumes) != 0},
+		{"sidecars", len(c.Sidecars) != 0},
+		{"initContainers", len(c.InitContainers) != 0},
+	}
+
+	for _, setting := range unsupported {
+		if setting.set {
+			return fmt.Errorf("component %s is deployed with %s and can't set %s", c.Name, deployer, setting.field)
+		}
+	}
+
+	if c.Helm != nil && len(c.Helm.Path) == 0 {
+		if len(c.Helm.Repository) == 0 || len(c.Helm.Chart) == 0 {
+			return fmt.Errorf("component %s needs either the path of its chart or a chart repository and a chart", c.Name)
+		}
+
+		repository, err := url.Parse(c.Helm.Repository)
+		if err != nil || repository.Scheme != "https" || len(repository.Host) == 0 {
+			return fmt.Errorf("component %s has an invalid chart repository %q, only https is supported", c.Name, c.Helm.Repository)
+		}
+
+		return nil
+	}
+
+	p := c.RepositoryPath()
+	if len(p) == 0 || path.IsAbs(p) || strings.HasPrefix(path.Clean(p), "..") {
+		return fmt.Errorf("component %s needs a path relative to the root of the repository, got %q", c.Name, p)
+	}
+
+	return nil
+}
@@ -1,5 +1,7 @@
 package v1alpha1
 
+import "fmt"
+
 type ImageSpec struct {
 	// RepositoryContext information is passed down to buildkit
 	// as instruction on how to proceed with the repository.
@@ -34,3 +36,42 @@ type RepositoryContextSpec struct {
 	// for the content of your build within the repository.
 	Path string `json:"path"`
 }
+
+// ValidateImages makes sure the images pushed to the same registry with the same
+// tag are built the same way. They would overwrite each other otherwise and every
+// component would run whichever image was pushed last. Images without a tag are
+// tagged with the workspace's tag.
+func ValidateImages(components []ComponentSpec) error {
+	type built struct {
+		component string
+		context   RepositoryContextSpec
+	}
+
+	pushed := make(map[string]built)
+	for _, component := range components {
+		for _, image := range component.Images() {
+			if image.Registry == nil {
+				continue
+			}
+
+			tag := ""
+			if image.Tag != nil {
+				tag = *image.Tag
+			}
+
+			var context RepositoryContextSpec
+			if image.RepositoryContext != nil {
+				context = *image.RepositoryContext
+			}
+
+			key := image.Registry.URL + ":" + tag
+			if other, ok := pushed[key]; ok && other.context != context {
+				return fmt.Errorf("components %s and %s push different images to %s with the same tag", other.component, component.Name, image.Registry.URL)
+			}
+
+			pushed[key] = built{component: component.Name, context: context}
+		}
+	}
+
+	return nil
+}
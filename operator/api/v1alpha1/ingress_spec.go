@@ -0,0 +1,128 @@
+package v1alpha1
+
+import (
+	"errors"
+	"strings"
+)
+
+// +kubebuilder:validation:Enum=Ingress;HTTPRoute
+type RoutingBackend string
+
+// Placeholder of the domain in the template of the hosts.
+const domainPlaceholder = "{{domain}}"
+
+const (
+	// Routes are networking.k8s.io/v1 Ingresses.
+	RoutingBackendIngress RoutingBackend = "Ingress"
+
+	// Routes are HTTPRoutes from the Gateway API attached to a Gateway.
+	RoutingBackendHTTPRoute RoutingBackend = "HTTPRoute"
+)
+
+// IngressSpec configures the routes created for the services that
+// set `ingress`. It's set in the operator's configuration and the project
+// can override the fields other than the Gateway and the domain.
+type IngressSpec struct {
+	// Backend emitting the routes. Defaults to Ingress.
+	// +optional
+	Backend RoutingBackend `json:"backend,omitempty"`
+
+	// Gateway the HTTPRoutes are attached to. It's required by the
+	// HTTPRoute backend and only set in the operator's configuration.
+	// +optional
+	Gateway *GatewayReference `json:"gateway,omitempty"`
+
+	// Template of the host of each ingress. The placeholders `{{ingress}}`, `{{component}}`,
+	// `{{workspace}}`, `{{branch}}`, `{{project}}` and `{{domain}}` are replaced
+	// with their value, ie. "{{ingress}}-{{workspace}}.{{domain}}". The template
+	// of a project has to end with ".{{domain}}".
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Domain the hosts are under. It's only set
+	// in the operator's configuration.
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// Name of the IngressClass of the ingresses. It's
+	// not used by the HTTPRoute backend.
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
+	// TLS is enabled on the ingresses when it's set. With the HTTPRoute
+	// backend, TLS is terminated by the Gateway and only the scheme
+	// of the URLs is affected.
+	// +optional
+	TLS *IngressTLSSpec `json:"tls,omitempty"`
+}
+
+type GatewayReference struct {
+	// Name of the Gateway.
+	Name string `json:"name"`
+
+	// Namespace of the Gateway. Defaults to the namespace of the routes.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the Gateway's listener the routes are attached to.
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+type IngressTLSSpec struct {
+	// Name of the secret holding the certificate. When it's not set, each
+	// ingress gets its own secret which is expected to be created by the issuer.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Annotations added to the ingresses so a certificate is issued for
+	// them, ie. `cert-manager.io/cluster-issuer: letsencrypt`.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ValidateOverride makes sure the project's override keeps its routes on the
+// operator's Gateway and their hosts under the operator's domain.
+func (i *IngressSpec) ValidateOverride() error {
+	if i.Gateway != nil {
+		return errors.New("the gateway of the routes can't be overridden")
+	}
+
+	if len(i.Domain) != 0 {
+		return errors.New("the domain of the routes can't be overridden")
+	}
+
+	if len(i.Host) != 0 && !strings.HasSuffix(i.Host, "."+domainPlaceholder) {
+		return errors.New("the host of the routes has to end with ." + domainPlaceholder)
+	}
+
+	return nil
+}
+
+// Merge returns a copy of the spec with the fields set in the override replacing
+// their values. The Gateway and the domain always come from the spec, and so does
+// the host unless the override's stays under the domain.
+func (i IngressSpec) Merge(override *IngressSpec) IngressSpec {
+	merged := *i.DeepCopy()
+	if override == nil {
+		return merged
+	}
+
+	if len(override.Backend) != 0 {
+		merged.Backend = override.Backend
+	}
+
+	if len(override.Host) != 0 && strings.HasSuffix(override.Host, "."+domainPlaceholder) {
+		merged.Host = override.Host
+	}
+
+	if len(override.ClassName) != 0 {
+		merged.ClassName = override.ClassName
+	}
+
+	if override.TLS != nil {
+		merged.TLS = override.TLS.DeepCopy()
+	}
+
+	return merged
+}
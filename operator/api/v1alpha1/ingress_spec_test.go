@@ -0,0 +1,50 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIngressSpecMerge(t *testing.T) {
+	spec := IngressSpec{
+		Backend: RoutingBackendHTTPRoute,
+		Gateway: &GatewayReference{Name: "public", Namespace: "gateways"},
+		Host:    "{{ingress}}-{{workspace}}.{{domain}}",
+		Domain:  "spot.example.com",
+	}
+
+	tests := []struct {
+		name     string
+		override *IngressSpec
+		want     IngressSpec
+	}{
+		{
+			name: "without an override",
+			want: spec,
+		},
+		{
+			name:     "host under the domain",
+			override: &IngressSpec{Host: "{{component}}.{{workspace}}.{{domain}}", ClassName: "nginx"},
+			want: IngressSpec{
+				Backend:   RoutingBackendHTTPRoute,
+				Gateway:   &GatewayReference{Name: "public", Namespace: "gateways"},
+				Host:      "{{component}}.{{workspace}}.{{domain}}",
+				Domain:    "spot.example.com",
+				ClassName: "nginx",
+			},
+		},
+		{
+			name:     "gateway, domain and host outside of the domain",
+			override: &IngressSpec{Gateway: &GatewayReference{Name: "internal"}, Domain: "example.com", Host: "{{workspace}}.example.com"},
+			want:     spec,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spec.Merge(tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
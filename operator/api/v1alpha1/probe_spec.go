@@ -0,0 +1,124 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ProbeSpec checks the health of a component. Only one
+// of `http`, `tcp` or `exec` should be set.
+type ProbeSpec struct {
+	// Sends a GET request to the path on the port, any
+	// status between 200 and 399 is a success.
+	// +optional
+	HTTP *HTTPProbeSpec `json:"http,omitempty"`
+
+	// Opens a TCP connection on the port.
+	// +optional
+	TCP *TCPProbeSpec `json:"tcp,omitempty"`
+
+	// Runs the command inside the container, it's a
+	// success if the command exits with 0.
+	// +optional
+	Exec *ExecProbeSpec `json:"exec,omitempty"`
+
+	// Seconds after the container started before the first check.
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+
+	// Seconds between each check.
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// Consecutive failures before the check is considered failed.
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+type HTTPProbeSpec struct {
+	Path string `json:"path"`
+	Port int    `json:"port"`
+}
+
+type TCPProbeSpec struct {
+	Port int `json:"port"`
+}
+
+type ExecProbeSpec struct {
+	Command []string `json:"command"`
+}
+
+// Probe converts the spec to the probe set on the container.
+func (p *ProbeSpec) Probe() *core.Probe {
+	probe := &core.Probe{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+
+	switch {
+	case p.HTTP != nil:
+		probe.HTTPGet = &core.HTTPGetAction{Path: p.HTTP.Path, Port: intstr.FromInt(p.HTTP.Port)}
+	case p.TCP != nil:
+		probe.TCPSocket = &core.TCPSocketAction{Port: intstr.FromInt(p.TCP.Port)}
+	case p.Exec != nil:
+		probe.Exec = &core.ExecAction{Command: p.Exec.Command}
+	}
+
+	return probe
+}
+
+// ValidateProbes makes sure the readiness and liveness checks of the component
+// each set exactly one kind of check with a valid port or command.
+func (c *ComponentSpec) ValidateProbes() error {
+	for _, probe := range []struct {
+		name string
+		spec *ProbeSpec
+	}{{"readiness", c.Readiness}, {"liveness", c.Liveness}} {
+		if probe.spec == nil {
+			continue
+		}
+
+		if err := probe.spec.validate(); err != nil {
+			return fmt.Errorf("component %s has an invalid %s check: %w", c.Name, probe.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *ProbeSpec) validate() error {
+	checks := 0
+	for _, set := range []bool{p.HTTP != nil, p.TCP != nil, p.Exec != nil} {
+		if set {
+			checks++
+		}
+	}
+
+	if checks != 1 {
+		return fmt.Errorf("exactly one of http, tcp or exec needs to be set, got %d", checks)
+	}
+
+	switch {
+	case p.HTTP != nil:
+		if p.HTTP.Port < 1 || p.HTTP.Port > 65535 {
+			return fmt.Errorf("invalid port: %d", p.HTTP.Port)
+		}
+	case p.TCP != nil:
+		if p.TCP.Port < 1 || p.TCP.Port > 65535 {
+			return fmt.Errorf("invalid port: %d", p.TCP.Port)
+		}
+	case p.Exec != nil:
+		if len(p.Exec.Command) == 0 {
+			return fmt.Errorf("the command is empty")
+		}
+	}
+
+	if p.InitialDelaySeconds < 0 || p.PeriodSeconds < 0 || p.FailureThreshold < 0 {
+		return fmt.Errorf("the delay, period and failure threshold can't be negative")
+	}
+
+	return nil
+}
@@ -17,25 +17,237 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"errors"
+	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+var ErrProjectComponentNotFound = errors.New("component is not part of the project")
+
+// Condition type set on a Project when its template was validated.
+const ProjectConditionValid = "Valid"
 
-// ProjectSpec defines the desired state of Project
+// ProjectSpec defines the desired state of Project. It's the template
+// every workspace of this project is instantiated from.
 type ProjectSpec struct {
 	Name string `json:"name,omitempty"`
+
+	// Default branch for the workspaces that don't set one. The URL
+	// of the branch is also used when a workspace only sets a branch name.
+	// +optional
+	Branch *BranchSpec `json:"branch,omitempty"`
+
+	// Components every workspace of this project is going to have, unless the workspace
+	// only picks a subset of them.
+	Components []ComponentSpec `json:"components,omitempty"`
+
+	// Environments shared by all the workspaces. A workspace can override
+	// any of them by declaring an environment with the same name.
+	Environments []EnvironmentSpec `json:"environments,omitempty"`
+
+	// WorkspaceTTL is the default TTL of the workspaces that don't set one.
+	// +optional
+	WorkspaceTTL *metav1.Duration `json:"workspaceTTL,omitempty"`
+
+	// Sleep is the default sleep schedule of the workspaces that don't set one.
+	// +optional
+	Sleep *SleepSchedule `json:"sleep,omitempty"`
+
+	// Ingress overrides the operator's ingress settings for the workspaces
+	// of this project. The Gateway and the domain can't be overridden.
+	// +optional
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// ComponentDefaults are the resources, scheduling and security settings
+	// of the components that don't set their own.
+	// +optional
+	ComponentDefaults *RuntimeSpec `json:"componentDefaults,omitempty"`
 }
 
 // ProjectStatus defines the observed state of Project
 type ProjectStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the generation of the template that was last validated.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions report whether the template is `Valid`.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Workspaces that were instantiated from this project.
+	Workspaces []ProjectWorkspaceStatus `json:"workspaces,omitempty"`
+}
+
+type ProjectWorkspaceStatus struct {
+	Name   string         `json:"name"`
+	Branch string         `json:"branch,omitempty"`
+	Stage  WorkspaceStage `json:"stage,omitempty"`
+}
+
+// Validate makes sure every workspace can be instantiated from this template.
+func (p *Project) Validate() error {
+	environments := make(map[string]bool)
+	for _, env := range p.Spec.Environments {
+		environments[env.Name] = true
+	}
+
+	if p.Spec.Ingress != nil {
+		if err := p.Spec.Ingress.ValidateOverride(); err != nil {
+			return err
+		}
+	}
+
+	components := make(map[string]bool)
+	for _, component := range p.Spec.Components {
+		if len(component.Name) == 0 {
+			return errors.New("every component needs a name")
+		}
+
+		if components[component.Name] {
+			return fmt.Errorf("component %s is declared more than once", component.Name)
+		}
+
+		components[component.Name] = true
+
+		if err := component.ValidateDeployer(); err != nil {
+			return err
+		}
+
+		for _, image := range component.Images() {
+			if image.Registry != nil && (p.Spec.Branch == nil || len(p.Spec.Branch.URL) == 0) {
+				return fmt.Errorf("component %s is built from the repository but the project doesn't have a branch URL", component.Name)
+			}
+		}
+
+		if component.FromRepository() && (p.Spec.Branch == nil || len(p.Spec.Branch.URL) == 0) {
+			return fmt.Errorf("component %s is deployed from the repository but the project doesn't have a branch URL", component.Name)
+		}
+
+		if err := component.ValidateServices(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateKind(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateAutoscaling(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateVolumes(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateContainers(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateProbes(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateRuntime(); err != nil {
+			return err
+		}
+
+		envs := append([]ComponentEnvironmentSpec{}, component.Environments...)
+		for _, container := range component.Containers() {
+			envs = append(envs, container.Environments...)
+		}
+
+		for _, env := range envs {
+			if env.Value == nil && !environments[env.Name] {
+				return fmt.Errorf("component %s references the environment %s which is not declared by the project", component.Name, env.Name)
+			}
+		}
+	}
+
+	if err := ValidateImages(p.Spec.Components); err != nil {
+		return err
+	}
+
+	_, err := SortComponents(p.Spec.Components)
+	return err
+}
+
+// Render fills the workspace's spec with this project's template. Anything the
+// workspace already sets is kept as an override:
+//   - The branch name and URL default to the project's branch.
+//   - The components are the project's components, or the subset listed in `spec.project.components`.
+//     Workspaces that already declare their components keep them.
+//   - The environments of the workspace are merged over the project's environments.
+func (p *Project) Render(spec *WorkspaceSpec) error {
+	if p.Spec.Branch != nil {
+		if len(spec.Branch.Name) == 0 {
+			spec.Branch.Name = p.Spec.Branch.Name
+		}
+
+		if len(spec.Branch.URL) == 0 {
+			spec.Branch.URL = p.Spec.Branch.URL
+		}
+	}
+
+	switch {
+	case len(spec.Components) != 0:
+		// The workspace overrides the project's components.
+	case len(spec.Project.Components) == 0:
+		spec.Components = append([]ComponentSpec{}, p.Spec.Components...)
+	default:
+		for _, name := range spec.Project.Components {
+			component := p.component(name)
+			if component == nil {
+				return fmt.Errorf("%w: %s", ErrProjectComponentNotFound, name)
+			}
+
+			spec.Components = append(spec.Components, *component.DeepCopy())
+		}
+	}
+
+	var environments []EnvironmentSpec
+	overrides := make(map[string]EnvironmentSpec)
+	for _, env := range spec.Environments {
+		overrides[env.Name] = env
+	}
+
+	for _, env := range p.Spec.Environments {
+		if override, ok := overrides[env.Name]; ok {
+			env = override
+			delete(overrides, env.Name)
+		}
+
+		environments = append(environments, env)
+	}
+
+	// Environments that only exist on the workspace
+	for _, env := range spec.Environments {
+		if _, ok := overrides[env.Name]; ok {
+			environments = append(environments, env)
+		}
+	}
+
+	spec.Environments = environments
+
+	return nil
+}
+
+func (p *Project) component(name string) *ComponentSpec {
+	for i := range p.Spec.Components {
+		if p.Spec.Components[i].Name == name {
+			return &p.Spec.Components[i]
+		}
+	}
+
+	return nil
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Valid",type=string,JSONPath=`.status.conditions[?(@.type=="Valid")].status`
 
 // Project is the Schema for the projects API
 type Project struct {
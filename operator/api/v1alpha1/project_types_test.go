@@ -0,0 +1,251 @@
+package v1alpha1
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProjectRender(t *testing.T) {
+	value := func(s string) *string { return &s }
+	project := &Project{
+		Spec: ProjectSpec{
+			Branch: &BranchSpec{Name: "main", URL: "github.com/my-org/my-repo"},
+			Components: []ComponentSpec{
+				{Name: "web", Image: ImageSpec{Name: "web"}},
+				{Name: "db", Image: ImageSpec{Name: "postgres"}},
+			},
+			Environments: []EnvironmentSpec{
+				{Name: "LOG_LEVEL", Value: "info"},
+				{Name: "DATABASE_URL", Value: "postgres://db"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		spec         WorkspaceSpec
+		branch       BranchSpec
+		components   []string
+		environments []EnvironmentSpec
+		err          error
+	}{
+		{
+			name:         "everything from the project",
+			branch:       BranchSpec{Name: "main", URL: "github.com/my-org/my-repo"},
+			components:   []string{"web", "db"},
+			environments: project.Spec.Environments,
+		},
+		{
+			name:         "branch override",
+			spec:         WorkspaceSpec{Branch: BranchSpec{Name: "feature"}},
+			branch:       BranchSpec{Name: "feature", URL: "github.com/my-org/my-repo"},
+			components:   []string{"web", "db"},
+			environments: project.Spec.Environments,
+		},
+		{
+			name:         "subset of the components",
+			spec:         WorkspaceSpec{Project: ProjectReference{Components: []string{"db"}}},
+			branch:       BranchSpec{Name: "main", URL: "github.com/my-org/my-repo"},
+			components:   []string{"db"},
+			environments: project.Spec.Environments,
+		},
+		{
+			name:         "components of the workspace",
+			spec:         WorkspaceSpec{Components: []ComponentSpec{{Name: "api", Environments: []ComponentEnvironmentSpec{{Name: "A", Value: value("b")}}}}},
+			branch:       BranchSpec{Name: "main", URL: "github.com/my-org/my-repo"},
+			components:   []string{"api"},
+			environments: project.Spec.Environments,
+		},
+		{
+			name: "environment overrides",
+			spec: WorkspaceSpec{Environments: []EnvironmentSpec{
+				{Name: "FEATURE", Value: "on"},
+				{Name: "LOG_LEVEL", Value: "debug"},
+			}},
+			branch:     BranchSpec{Name: "main", URL: "github.com/my-org/my-repo"},
+			components: []string{"web", "db"},
+			environments: []EnvironmentSpec{
+				{Name: "LOG_LEVEL", Value: "debug"},
+				{Name: "DATABASE_URL", Value: "postgres://db"},
+				{Name: "FEATURE", Value: "on"},
+			},
+		},
+		{
+			name: "unknown component",
+			spec: WorkspaceSpec{Project: ProjectReference{Components: []string{"cache"}}},
+			err:  ErrProjectComponentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			err := project.Render(&spec)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if spec.Branch != tt.branch {
+				t.Errorf("got branch %+v, want %+v", spec.Branch, tt.branch)
+			}
+
+			var components []string
+			for _, component := range spec.Components {
+				components = append(components, component.Name)
+			}
+
+			if !reflect.DeepEqual(components, tt.components) {
+				t.Errorf("got components %v, want %v", components, tt.components)
+			}
+
+			if !reflect.DeepEqual(spec.Environments, tt.environments) {
+				t.Errorf("got environments %+v, want %+v", spec.Environments, tt.environments)
+			}
+		})
+	}
+}
+
+func TestProjectValidate(t *testing.T) {
+	tag := func(s string) *string { return &s }
+	branch := &BranchSpec{Name: "main", URL: "github.com/my-org/my-repo"}
+	built := ImageSpec{
+		Name:              "web",
+		Registry:          &RegistrySpec{URL: "registry.example.com/web"},
+		RepositoryContext: &RepositoryContextSpec{Dockerfile: "Dockerfile", Path: "."},
+	}
+
+	tests := []struct {
+		name string
+		spec ProjectSpec
+		err  bool
+	}{
+		{
+			name: "valid",
+			spec: ProjectSpec{
+				Branch:       branch,
+				Environments: []EnvironmentSpec{{Name: "DATABASE_URL", Value: "postgres://db"}},
+				Components: []ComponentSpec{
+					{Name: "web", Image: built, DependsOn: []string{"db"}, Environments: []ComponentEnvironmentSpec{{Name: "DATABASE_URL"}}},
+					{Name: "db", Image: ImageSpec{Name: "postgres"}},
+				},
+			},
+		},
+		{
+			name: "component without a name",
+			spec: ProjectSpec{Components: []ComponentSpec{{Image: ImageSpec{Name: "nginx"}}}},
+			err:  true,
+		},
+		{
+			name: "ingress override",
+			spec: ProjectSpec{Ingress: &IngressSpec{Host: "{{component}}.{{workspace}}.{{domain}}", ClassName: "nginx"}},
+		},
+		{
+			name: "ingress override with a gateway",
+			spec: ProjectSpec{Ingress: &IngressSpec{Gateway: &GatewayReference{Name: "internal"}}},
+			err:  true,
+		},
+		{
+			name: "ingress override with a domain",
+			spec: ProjectSpec{Ingress: &IngressSpec{Domain: "example.com"}},
+			err:  true,
+		},
+		{
+			name: "ingress override with a host outside of the domain",
+			spec: ProjectSpec{Ingress: &IngressSpec{Host: "{{workspace}}.example.com"}},
+			err:  true,
+		},
+		{
+			name: "component declared twice",
+			spec: ProjectSpec{Components: []ComponentSpec{
+				{Name: "web", Image: ImageSpec{Name: "nginx"}},
+				{Name: "web", Image: ImageSpec{Name: "nginx"}},
+			}},
+			err: true,
+		},
+		{
+			name: "built image without a branch",
+			spec: ProjectSpec{Components: []ComponentSpec{{Name: "web", Image: built}}},
+			err:  true,
+		},
+		{
+			name: "manifests without a branch",
+			spec: ProjectSpec{Components: []ComponentSpec{{Name: "web", Manifests: &ManifestsSpec{Path: "deploy"}}}},
+			err:  true,
+		},
+		{
+			name: "undeclared environment",
+			spec: ProjectSpec{Components: []ComponentSpec{
+				{Name: "web", Image: ImageSpec{Name: "nginx"}, Environments: []ComponentEnvironmentSpec{{Name: "SECRET"}}},
+			}},
+			err: true,
+		},
+		{
+			name: "images overwriting each other",
+			spec: ProjectSpec{
+				Branch: branch,
+				Components: []ComponentSpec{
+					{Name: "web", Image: built},
+					{Name: "worker", Image: ImageSpec{
+						Name:              "worker",
+						Registry:          built.Registry,
+						RepositoryContext: &RepositoryContextSpec{Dockerfile: "Dockerfile.worker", Path: "."},
+					}},
+				},
+			},
+			err: true,
+		},
+		{
+			name: "images with distinct tags",
+			spec: ProjectSpec{
+				Branch: branch,
+				Components: []ComponentSpec{
+					{Name: "web", Image: built},
+					{Name: "worker", Image: ImageSpec{
+						Name:              "worker",
+						Registry:          built.Registry,
+						RepositoryContext: &RepositoryContextSpec{Dockerfile: "Dockerfile.worker", Path: "."},
+						Tag:               tag("worker"),
+					}},
+				},
+			},
+		},
+		{
+			name: "dependency cycle",
+			spec: ProjectSpec{Components: []ComponentSpec{
+				{Name: "web", Image: ImageSpec{Name: "nginx"}, DependsOn: []string{"api"}},
+				{Name: "api", Image: ImageSpec{Name: "api"}, DependsOn: []string{"web"}},
+			}},
+			err: true,
+		},
+		{
+			name: "invalid component",
+			spec: ProjectSpec{Components: []ComponentSpec{
+				{Name: "web", Image: ImageSpec{Name: "nginx"}, Services: []ServiceSpec{{Port: 0}}},
+			}},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &Project{Spec: tt.spec}
+			err := project.Validate()
+			if tt.err && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+)
+
+// RuntimeSpec is how the pods of a component run: the resources they get,
+// where they are scheduled and with which privileges. The project can
+// set them as defaults for every component of its workspaces.
+type RuntimeSpec struct {
+	// Resources requested by the container and its limits. The operator
+	// can cap them, containers without limits are then limited to the cap.
+	// +optional
+	Resources *core.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector the pods need to match to be scheduled on a node.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the pods.
+	// +optional
+	Tolerations []core.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity of the pods.
+	// +optional
+	Affinity *core.Affinity `json:"affinity,omitempty"`
+
+	// Name of the ServiceAccount the pods run as. It needs to exist in
+	// the workspace's namespace.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Security settings of the containers. Containers run as a non-root user
+	// without privilege escalation unless they explicitly opt out.
+	// +optional
+	Security *SecuritySpec `json:"security,omitempty"`
+}
+
+type SecuritySpec struct {
+	// RunAsRoot lets the container run as root. It's required
+	// to run as a non-root user otherwise.
+	// +optional
+	RunAsRoot *bool `json:"runAsRoot,omitempty"`
+
+	// AllowPrivilegeEscalation lets a process of the container gain
+	// more privileges than its parent. It's disabled by default.
+	// +optional
+	AllowPrivilegeEscalation *bool `json:"allowPrivilegeEscalation,omitempty"`
+
+	// User the container runs as. Images that set a user by name
+	// need it to be set as a name can't be verified as non-root.
+	// +optional
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+
+	// Group the container runs as.
+	// +optional
+	RunAsGroup *int64 `json:"runAsGroup,omitempty"`
+
+	// Group owning the volumes mounted in the pod.
+	// +optional
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+
+	// ReadOnlyRootFilesystem mounts the container's root filesystem as read-only.
+	// +optional
+	ReadOnlyRootFilesystem *bool `json:"readOnlyRootFilesystem,omitempty"`
+}
+
+// Merge returns a copy of the spec where the fields that are not set
+// are taken from the defaults. Resources and node selectors are merged
+// key by key, the spec's values win.
+func (r RuntimeSpec) Merge(defaults *RuntimeSpec) RuntimeSpec {
+	merged := *r.DeepCopy()
+	if defaults == nil {
+		return merged
+	}
+
+	if defaults.Resources != nil {
+		if merged.Resources == nil {
+			merged.Resources = &core.ResourceRequirements{}
+		}
+
+		merged.Resources.Requests = mergeResources(merged.Resources.Requests, defaults.Resources.Requests)
+		merged.Resources.Limits = mergeResources(merged.Resources.Limits, defaults.Resources.Limits)
+	}
+
+	for key, value := range defaults.NodeSelector {
+		if _, ok := merged.NodeSelector[key]; ok {
+			continue
+		}
+
+		if merged.NodeSelector == nil {
+			merged.NodeSelector = make(map[string]string)
+		}
+
+		merged.NodeSelector[key] = value
+	}
+
+	if len(merged.Tolerations) == 0 && len(defaults.Tolerations) != 0 {
+		merged.Tolerations = defaults.DeepCopy().Tolerations
+	}
+
+	if merged.Affinity == nil && defaults.Affinity != nil {
+		merged.Affinity = defaults.Affinity.DeepCopy()
+	}
+
+	if len(merged.ServiceAccountName) == 0 {
+		merged.ServiceAccountName = defaults.ServiceAccountName
+	}
+
+	if defaults.Security != nil {
+		if merged.Security == nil {
+			merged.Security = &SecuritySpec{}
+		}
+
+		security, fallback := merged.Security, defaults.Security.DeepCopy()
+		if security.RunAsRoot == nil {
+			security.RunAsRoot = fallback.RunAsRoot
+		}
+
+		if security.AllowPrivilegeEscalation == nil {
+			security.AllowPrivilegeEscalation = fallback.AllowPrivilegeEscalation
+		}
+
+		if security.RunAsUser == nil {
+			security.RunAsUser = fallback.RunAsUser
+		}
+
+		if security.RunAsGroup == nil {
+			security.RunAsGroup = fallback.RunAsGroup
+		}
+
+		if security.FSGroup == nil {
+			security.FSGroup = fallback.FSGroup
+		}
+
+		if security.ReadOnlyRootFilesystem == nil {
+			security.ReadOnlyRootFilesystem = fallback.ReadOnlyRootFilesystem
+		}
+	}
+
+	return merged
+}
+
+// SecurityContext returns the security context of the container. It runs
+// as non-root without privilege escalation unless the spec opts out.
+func (s *SecuritySpec) SecurityContext() *core.SecurityContext {
+	runAsNonRoot := true
+	allowPrivilegeEscalation := false
+
+	context := &core.SecurityContext{
+		RunAsNonRoot:             &runAsNonRoot,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+	}
+
+	if s == nil {
+		return context
+	}
+
+	if s.RunAsRoot != nil {
+		runAsNonRoot = !*s.RunAsRoot
+	}
+
+	if s.AllowPrivilegeEscalation != nil {
+		allowPrivilegeEscalation = *s.AllowPrivilegeEscalation
+	}
+
+	context.RunAsUser = s.RunAsUser
+	context.RunAsGroup = s.RunAsGroup
+	context.ReadOnlyRootFilesystem = s.ReadOnlyRootFilesystem
+
+	return context
+}
+
+// PodSecurityContext returns the settings that apply to the whole pod.
+func (s *SecuritySpec) PodSecurityContext() *core.PodSecurityContext {
+	if s == nil || s.FSGroup == nil {
+		return nil
+	}
+
+	return &core.PodSecurityContext{FSGroup: s.FSGroup}
+}
+
+// ValidateRuntime makes sure the resources of the component and of its additional
+// containers don't request more than their limits. The defaults of the project are
+// checked against the operator's caps when the component is deployed.
+func (c *ComponentSpec) ValidateRuntime() error {
+	if err := validateResources(c.Resources); err != nil {
+		return fmt.Errorf("component %s: %w", c.Name, err)
+	}
+
+	for _, container := range c.Containers() {
+		if err := validateResources(container.Resources); err != nil {
+			return fmt.Errorf("container %s of component %s: %w", container.Name, c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateResources(resources *core.ResourceRequirements) error {
+	if resources == nil {
+		return nil
+	}
+
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("the %s request %s is above its limit %s", name, request.String(), limit.String())
+		}
+	}
+
+	return nil
+}
+
+func mergeResources(resources, defaults core.ResourceList) core.ResourceList {
+	for name, quantity := range defaults {
+		if _, ok := resources[name]; ok {
+			continue
+		}
+
+		if resources == nil {
+			resources = make(core.ResourceList)
+		}
+
+		resources[name] = quantity.DeepCopy()
+	}
+
+	return resources
+}
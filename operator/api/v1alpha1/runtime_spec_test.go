@@ -0,0 +1,79 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestRuntimeSpecMerge(t *testing.T) {
+	enabled := func(b bool) *bool { return &b }
+	user := func(id int64) *int64 { return &id }
+
+	tests := []struct {
+		name     string
+		spec     RuntimeSpec
+		defaults *RuntimeSpec
+		want     RuntimeSpec
+	}{
+		{
+			name: "without defaults",
+			spec: RuntimeSpec{ServiceAccountName: "web"},
+			want: RuntimeSpec{ServiceAccountName: "web"},
+		},
+		{
+			name:     "empty spec takes the defaults",
+			defaults: &RuntimeSpec{ServiceAccountName: "default", NodeSelector: map[string]string{"pool": "spot"}},
+			want:     RuntimeSpec{ServiceAccountName: "default", NodeSelector: map[string]string{"pool": "spot"}},
+		},
+		{
+			name: "resources are merged by name",
+			spec: RuntimeSpec{Resources: &core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceCPU: resource.MustParse("500m")},
+			}},
+			defaults: &RuntimeSpec{Resources: &core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceCPU: resource.MustParse("100m"), core.ResourceMemory: resource.MustParse("128Mi")},
+				Limits:   core.ResourceList{core.ResourceMemory: resource.MustParse("256Mi")},
+			}},
+			want: RuntimeSpec{Resources: &core.ResourceRequirements{
+				Requests: core.ResourceList{core.ResourceCPU: resource.MustParse("500m"), core.ResourceMemory: resource.MustParse("128Mi")},
+				Limits:   core.ResourceList{core.ResourceMemory: resource.MustParse("256Mi")},
+			}},
+		},
+		{
+			name:     "node selectors are merged by key",
+			spec:     RuntimeSpec{NodeSelector: map[string]string{"pool": "web"}},
+			defaults: &RuntimeSpec{NodeSelector: map[string]string{"pool": "spot", "zone": "a"}},
+			want:     RuntimeSpec{NodeSelector: map[string]string{"pool": "web", "zone": "a"}},
+		},
+		{
+			name:     "tolerations are replaced",
+			spec:     RuntimeSpec{Tolerations: []core.Toleration{{Key: "web"}}},
+			defaults: &RuntimeSpec{Tolerations: []core.Toleration{{Key: "spot"}, {Key: "other"}}},
+			want:     RuntimeSpec{Tolerations: []core.Toleration{{Key: "web"}}},
+		},
+		{
+			name:     "security settings are merged one by one",
+			spec:     RuntimeSpec{Security: &SecuritySpec{RunAsRoot: enabled(true)}},
+			defaults: &RuntimeSpec{Security: &SecuritySpec{RunAsRoot: enabled(false), RunAsUser: user(1000)}},
+			want:     RuntimeSpec{Security: &SecuritySpec{RunAsRoot: enabled(true), RunAsUser: user(1000)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := *tt.spec.DeepCopy()
+			got := tt.spec.Merge(tt.defaults)
+
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			if !equality.Semantic.DeepEqual(tt.spec, spec) {
+				t.Errorf("the spec was modified: %+v", tt.spec)
+			}
+		})
+	}
+}
@@ -7,6 +7,44 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 )
 
+const (
+	// WorkspaceLabel is set on every object the operator creates on behalf of a
+	// Workspace. The value is the name of the Workspace.
+	WorkspaceLabel = "spot.release.com/workspace"
+
+	// ComponentLabel is set on every object that belongs to a component
+	// of a Workspace. The value is the name of the component.
+	ComponentLabel = "spot.release.com/component"
+
+	// ProjectLabel is set on the workspaces that belong to a Project.
+	// The value is the name of the project.
+	ProjectLabel = "spot.release.com/project"
+
+	// PinnedAnnotation protects a workspace from being reaped when
+	// it expires. The workspace is pinned when the value is "true".
+	PinnedAnnotation = "spot.release.com/pinned"
+
+	// LastActivityAnnotation is set by the receiver every time a webhook is
+	// received for a workspace. The value is a RFC3339 timestamp.
+	LastActivityAnnotation = "spot.release.com/last-activity"
+
+	// RetryAnnotation resumes a workspace that errored. The workspace is
+	// retried every time the value changes, ie. with a timestamp.
+	RetryAnnotation = "spot.release.com/retry"
+
+	// WakeRequestedAnnotation is set by the receiver when a request comes in
+	// for a sleeping workspace. The value is a RFC3339 timestamp.
+	WakeRequestedAnnotation = "spot.release.com/wake-requested"
+
+	// LastRequestAnnotation is set by the receiver while it proxies the requests
+	// of a workspace that was woken up. The value is a RFC3339 timestamp.
+	LastRequestAnnotation = "spot.release.com/last-request"
+
+	// BuildLabel is set on the builder pods so they can be found from
+	// their Build, even when they live in a different namespace.
+	BuildLabel = "spot.release.com/build"
+)
+
 type PodReference struct {
 	// `namespace` is the namespace of the pod.
 	// Required
@@ -46,3 +84,29 @@ type BuildReference struct {
 func (b BuildReference) String() string {
 	return fmt.Sprintf("%s/%s", b.Namespace, b.Name)
 }
+
+// ResourceReference points to any object the operator managed
+// on behalf of a Workspace.
+type ResourceReference struct {
+	// `apiVersion` is the group and version of the object. It's only set
+	// for the objects rendered from the manifests of the components.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// `kind` is the kind of the object.
+	// Required
+	Kind string `json:"kind"`
+	// `namespace` is the namespace of the object, empty
+	// when the object is cluster scoped.
+	Namespace string `json:"namespace,omitempty"`
+	// `name` is the name of the object.
+	// Required
+	Name string `json:"name"`
+}
+
+func (r ResourceReference) String() string {
+	if len(r.Namespace) == 0 {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
@@ -0,0 +1,103 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// +kubebuilder:validation:Enum=Delete;Retain
+type VolumeReclaimPolicy string
+
+const (
+	// The volume is deleted along with the workspace.
+	VolumeReclaimPolicyDelete VolumeReclaimPolicy = "Delete"
+
+	// The PersistentVolume is kept once the workspace is deleted so
+	// the data can be recovered. It has to be cleaned up manually.
+	VolumeReclaimPolicyRetain VolumeReclaimPolicy = "Retain"
+)
+
+// VolumeSpec is a persistent volume mounted in the component's
+// container. The data survives the pods being recreated.
+type VolumeSpec struct {
+	// Name of the volume, unique within the component.
+	Name string `json:"name"`
+
+	// Size of the volume, ie. "10Gi".
+	Size resource.Quantity `json:"size"`
+
+	// Path where the volume is mounted in the container.
+	MountPath string `json:"mountPath"`
+
+	// StorageClass of the volume. The cluster's default
+	// storage class is used when it's not set.
+	// +optional
+	StorageClass *string `json:"storageClass,omitempty"`
+
+	// ReclaimPolicy tells what happens to the volume when the
+	// workspace is deleted. Defaults to Delete.
+	// +optional
+	ReclaimPolicy VolumeReclaimPolicy `json:"reclaimPolicy,omitempty"`
+}
+
+// GetReclaimPolicy returns the reclaim policy of the
+// volume, defaulting to Delete.
+func (v *VolumeSpec) GetReclaimPolicy() VolumeReclaimPolicy {
+	if len(v.ReclaimPolicy) == 0 {
+		return VolumeReclaimPolicyDelete
+	}
+
+	return v.ReclaimPolicy
+}
+
+// ValidateVolumes makes sure the volumes of the component have unique
+// names that can be used in the name of their claim and that
+// they are mounted at distinct absolute paths. The claims can only be
+// mounted by one pod so components with volumes run a single replica.
+func (c *ComponentSpec) ValidateVolumes() error {
+	if len(c.Volumes) == 0 {
+		return nil
+	}
+
+	if c.Replicas != nil && *c.Replicas > 1 {
+		return fmt.Errorf("component %s has volumes and can't run more than one replica", c.Name)
+	}
+
+	if c.Autoscaling != nil {
+		return fmt.Errorf("component %s has volumes and can't be autoscaled", c.Name)
+	}
+
+	names := make(map[string]bool)
+	paths := make(map[string]bool)
+
+	for _, volume := range c.Volumes {
+		if errs := validation.IsDNS1123Label(volume.Name); len(errs) != 0 {
+			return fmt.Errorf("component %s has an invalid volume name %q: %s", c.Name, volume.Name, errs[0])
+		}
+
+		if names[volume.Name] {
+			return fmt.Errorf("component %s has more than one volume named %s", c.Name, volume.Name)
+		}
+
+		if volume.Size.Sign() <= 0 {
+			return fmt.Errorf("volume %s of component %s needs a size", volume.Name, c.Name)
+		}
+
+		if !path.IsAbs(volume.MountPath) {
+			return fmt.Errorf("volume %s of component %s needs an absolute mount path", volume.Name, c.Name)
+		}
+
+		mountPath := path.Clean(volume.MountPath)
+		if paths[mountPath] {
+			return fmt.Errorf("component %s mounts more than one volume at %s", c.Name, mountPath)
+		}
+
+		names[volume.Name] = true
+		paths[mountPath] = true
+	}
+
+	return nil
+}
@@ -17,10 +17,15 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// +kubebuilder:validation:Enum=Building;Deploying;Running;Updating;Errored;Terminating;Deleted
+// +kubebuilder:validation:Enum=Building;Deploying;Running;Updating;Sleeping;Errored;Terminating;Deleted
 type WorkspaceStage string
 
 const (
@@ -29,11 +34,16 @@ const (
 	WorkspaceStageDeploying   WorkspaceStage = "Deploying"
 	WorkspaceStageRunning     WorkspaceStage = "Running"
 	WorkspaceStageUpdating    WorkspaceStage = "Updating"
+	WorkspaceStageSleeping    WorkspaceStage = "Sleeping"
 	WorkspaceStageError       WorkspaceStage = "Errored"
 	WorkspaceStageTerminating WorkspaceStage = "Terminating"
 	WorkspaceStageDeleted     WorkspaceStage = "Deleted"
 )
 
+// WorkspaceFinalizer is registered on every Workspace so the operator
+// can tear down everything it created before the Workspace is released.
+const WorkspaceFinalizer = "spot.release.com/teardown"
+
 type WorkspaceSpec struct {
 	Branch BranchSpec `json:"branch"`
 
@@ -41,31 +51,174 @@ type WorkspaceSpec struct {
 	// workspace to deploy.
 	Components []ComponentSpec `json:"components,omitempty"`
 
-	// Defines all the environments that will be needed for this workspace
-	Environments []EnvironmentSpec `json:"environments"`
+	// Defines all the environments that will be needed for this workspace. When the
+	// workspace is instantiated from its project, these are overrides
+	// of the project's environments.
+	Environments []EnvironmentSpec `json:"environments,omitempty"`
 
-	// Name of the project this workspace belongs to. Can maybe replace it with
-	// a metadata label and owner reference.
-	Project ProjectSpec `json:"project"`
+	// Project this workspace belongs to. A workspace that doesn't declare
+	// any component is instantiated from its project's template.
+	Project ProjectReference `json:"project"`
 
 	// Default tag for all the images that are build that don't
 	// have a tag specified to them. If no value is set,
 	// it will be created before the builds starts.
 	// +optional
 	Tag *string `json:"tag,omitempty"`
+
+	// TTL is how long the workspace is kept around without any activity. The
+	// workspace is deleted once it expires. Defaults to the project's `workspaceTTL`,
+	// the workspace never expires if neither are set.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// Sleep is the schedule during which the components of the workspace are
+	// scaled down. Defaults to the project's `sleep` schedule.
+	// +optional
+	Sleep *SleepSchedule `json:"sleep,omitempty"`
+}
+
+// Validate makes sure the services of the components are valid
+// and that the dependencies between them can be resolved.
+func (s *WorkspaceSpec) Validate() error {
+	for _, component := range s.Components {
+		if err := component.ValidateServices(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateKind(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateAutoscaling(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateVolumes(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateContainers(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateProbes(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateRuntime(); err != nil {
+			return err
+		}
+
+		if err := component.ValidateDeployer(); err != nil {
+			return err
+		}
+	}
+
+	if err := ValidateImages(s.Components); err != nil {
+		return err
+	}
+
+	_, err := SortComponents(s.Components)
+	return err
+}
+
+// SleepSchedule defines recurring windows where a workspace is asleep. The workspace
+// goes to sleep at every occurence of `sleep` and wakes up at the next occurence
+// of `wake`. Images and services are kept while the workspace sleeps so
+// waking it up doesn't trigger any build.
+type SleepSchedule struct {
+	// Cron expression of when the workspace goes to sleep, ie. "0 20 * * 1-5".
+	Sleep string `json:"sleep"`
+
+	// Cron expression of when the workspace wakes up, ie. "0 7 * * 1-5".
+	Wake string `json:"wake"`
+
+	// IANA name of the time zone the expressions are evaluated
+	// in, ie. "America/Montreal". Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// IdleTimeout is how long a workspace that was woken up by a request
+	// stays up without receiving any traffic before it goes back to
+	// sleep. Defaults to 30 minutes.
+	// +optional
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
 }
 
 type BranchSpec struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type ProjectReference struct {
+	// Name of the Project, in the same namespace as the workspace.
 	Name string `json:"name"`
-	URL  string `json:"url"`
+
+	// Subset of the project's components this workspace is made of.
+	// All the components are used when it's empty.
+	// +optional
+	Components []string `json:"components,omitempty"`
 }
 
 type ServiceSpec struct {
-	Ingress  string `json:"ingress,omitempty"`
-	Port     int    `json:"port"`
+	// Name of the port on the service and the container. Defaults
+	// to the protocol followed by the port, ie. `tcp-3000`.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Ingress exposes the port outside of the cluster. The value is used to
+	// build the host of the ingress from the host template.
+	// +optional
+	Ingress string `json:"ingress,omitempty"`
+
+	// Path prefix routed to the port by the ingress. Defaults to `/`.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	Port int `json:"port"`
+
+	// Protocol of the port, one of `tcp`, `udp` or `sctp`. Application
+	// protocols (`http`, `https`, `http2`, `grpc`) are served over
+	// TCP. Defaults to `tcp`.
+	// +optional
 	Protocol string `json:"protocol,omitempty"`
 }
 
+// PortName returns the name of the port for this service.
+func (s *ServiceSpec) PortName() string {
+	if len(s.Name) != 0 {
+		return s.Name
+	}
+
+	protocol := strings.ToLower(s.Protocol)
+	if len(protocol) == 0 {
+		protocol = "tcp"
+	}
+
+	return fmt.Sprintf("%s-%d", protocol, s.Port)
+}
+
+// TransportProtocol maps the protocol of the service to the protocol of
+// the port. The application protocol is returned for the protocols served
+// over TCP that have one.
+func (s *ServiceSpec) TransportProtocol() (core.Protocol, *string, error) {
+	protocol := strings.ToLower(s.Protocol)
+
+	switch protocol {
+	case "", "tcp":
+		return core.ProtocolTCP, nil, nil
+	case "udp":
+		return core.ProtocolUDP, nil, nil
+	case "sctp":
+		return core.ProtocolSCTP, nil, nil
+	case "http", "https", "http2", "grpc":
+		return core.ProtocolTCP, &protocol, nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported protocol %q for port %d", s.Protocol, s.Port)
+}
+
 type EnvironmentSpec struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
@@ -75,25 +228,204 @@ type EnvironmentSpec struct {
 type WorkspaceStatus struct {
 	// ManagedNamespace is the namespace that will be associated with this workspace.
 	// All k8s objects that will need to exist for this workspace will live under that
-	// namespace
-	Namespace string `json:"namespace,omitempty"` //omitempty until the code exists
+	// namespace. It's created by the operator when the workspace is initialized and
+	// its name is derived from the project and the branch.
+	Namespace string `json:"namespace,omitempty"`
 
 	Stage WorkspaceStage `json:"stage"`
 
+	// StageTransitionTime is the last time the workspace moved to a different stage.
+	// +optional
+	StageTransitionTime *metav1.Time `json:"stageTransitionTime,omitempty"`
+
+	// FailedStage is the stage the workspace was in when it last errored. A
+	// retry resumes the workspace from that stage. An empty value with the
+	// Errored stage means the workspace failed while being initialized.
+	// +optional
+	FailedStage WorkspaceStage `json:"failedStage,omitempty"`
+
+	// RetryCount is how many times the workspace was retried after an error.
+	// +optional
+	RetryCount int `json:"retryCount,omitempty"`
+
+	// LastRetry is the value of the retry annotation that was last
+	// handled. A different value triggers a new retry.
+	// +optional
+	LastRetry string `json:"lastRetry,omitempty"`
+
+	// Conditions give more details about the workspace's stage. `Ready` is true only
+	// when the workspace runs with its latest spec.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// ObservedGeneration is the generation of the spec the builds and
+	// components were last created from. When it's behind the workspace's
+	// generation, the workspace goes through the Updating stage.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// Builds are the unit of work associated for each of the builds
 	// that are required for this workspace to launch. Builds are seeding
 	// the Images as they complete.
 	Builds []BuildReference `json:"builds,omitempty"`
 
+	// BuildProgress counts the builds listed in `Builds` by their stage.
+	BuildProgress BuildProgress `json:"buildProgress,omitempty"`
+
 	// Images are seeded by Builds as they are completed. It's
 	// also possible for some services in a workspace to have images that don't
 	// require a build (think database, etc.).
 	Images map[string]BuildImage `json:"images,omitempty"`
+
+	// Commit the branch pointed to when the builds started. The images are
+	// built from it and the manifests of the components are rendered from it.
+	// It's empty when the branch couldn't be resolved.
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// CommitGeneration is the generation of the workspace the commit was
+	// resolved for. The branch is only resolved once per generation.
+	// +optional
+	CommitGeneration int64 `json:"commitGeneration,omitempty"`
+
+	// Components holds the state of each of the components deployed for
+	// this workspace, keyed by the component's name.
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+
+	// Routes exposing the components outside of the cluster.
+	// +optional
+	Routes []RouteStatus `json:"routes,omitempty"`
+
+	// Volumes of the components and the claims backing them.
+	// +optional
+	Volumes []VolumeStatus `json:"volumes,omitempty"`
+
+	// WokenAt is when a request woke up the workspace while its sleep schedule
+	// had it asleep. It's cleared when the workspace goes back to sleep or when
+	// the schedule wakes it up.
+	// +optional
+	WokenAt *metav1.Time `json:"wokenAt,omitempty"`
+
+	// Expiry tracks the activity of the workspace to know when it expires.
+	// +optional
+	Expiry *ExpiryStatus `json:"expiry,omitempty"`
+
+	// Removed lists every object that was deleted while the workspace
+	// was terminating, in the order they were removed.
+	Removed []ResourceReference `json:"removed,omitempty"`
+}
+
+type ExpiryStatus struct {
+	// LastActivityTime is the last time the workspace's spec changed or
+	// the receiver got a webhook for this workspace.
+	LastActivityTime metav1.Time `json:"lastActivityTime"`
+
+	// ObservedGeneration is the generation of the workspace when the activity
+	// was last recorded. A newer generation means the spec changed.
+	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// ExpiresAt is when the workspace is going to be deleted. It's not set
+	// when the workspace is pinned.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// WarnedAt is when the warning about the upcoming expiry was emitted.
+	// +optional
+	WarnedAt *metav1.Time `json:"warnedAt,omitempty"`
+}
+
+type BuildProgress struct {
+	Pending int `json:"pending"`
+	Running int `json:"running"`
+	Done    int `json:"done"`
+	Errored int `json:"errored"`
+}
+
+type RouteStatus struct {
+	// Name of the component this route sends the traffic to.
+	Component string `json:"component"`
+
+	// Host the route answers to.
+	Host string `json:"host"`
+
+	// Path prefix of the route.
+	Path string `json:"path"`
+
+	// URL where the component can be reached.
+	URL string `json:"url"`
+
+	// Name of the component's service in the workspace's namespace.
+	Service string `json:"service"`
+
+	// Port of the service the traffic is sent to.
+	Port int32 `json:"port"`
+}
+
+type VolumeStatus struct {
+	// Name of the component the volume is mounted in.
+	Component string `json:"component"`
+
+	// Name of the volume in the component's spec.
+	Name string `json:"name"`
+
+	// Name of the PersistentVolumeClaim in the workspace's namespace.
+	Claim string `json:"claim"`
+
+	// Phase of the claim, ie. Pending until the volume is provisioned.
+	// +optional
+	Phase core.PersistentVolumeClaimPhase `json:"phase,omitempty"`
+
+	// Capacity of the provisioned volume.
+	// +optional
+	Capacity *resource.Quantity `json:"capacity,omitempty"`
+
+	// Name of the PersistentVolume bound to the claim.
+	// +optional
+	VolumeName string `json:"volumeName,omitempty"`
+
+	// What happens to the volume when the workspace is deleted.
+	ReclaimPolicy VolumeReclaimPolicy `json:"reclaimPolicy"`
+}
+
+type ComponentStatus struct {
+	// Hash of the component's spec, environments and image it was
+	// last deployed with. A component is only rolled out again when
+	// its hash changes. It's empty until the component is deployed.
+	Hash string `json:"hash,omitempty"`
+
+	// WaitingOn lists the dependencies that are not ready yet. The
+	// component is deployed once they are all ready.
+	// +optional
+	WaitingOn []string `json:"waitingOn,omitempty"`
+
+	// Image the component runs. Images built for the workspace are
+	// pinned to the digest their Build pushed.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Objects rendered for the components deployed from manifests. The
+	// ones that are not rendered anymore are removed when it's rolled out.
+	// +optional
+	Objects []ResourceReference `json:"objects,omitempty"`
+
+	// Replicas is the number of pods the component runs, as last observed.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// DesiredReplicas is the number of pods the component is scaled to.
+	// For autoscaled components, it's the number the autoscaler settled on.
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Stage",type=string,JSONPath=`.status.stage`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Expires",type=string,JSONPath=`.status.expiry.expiresAt`
 
 // Workspace is the Schema for the workspaces API
 type Workspace struct {
@@ -59,16 +59,14 @@ var _ webhook.Validator = &Workspace{}
 func (r *Workspace) ValidateCreate() error {
 	workspacelog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
+	return r.Spec.Validate()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Workspace) ValidateUpdate(old runtime.Object) error {
 	workspacelog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil
+	return r.Spec.Validate()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
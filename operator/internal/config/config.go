@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// Config holds the operator level settings. It is loaded from the YAML
+// file passed with the `--config` flag. Every setting is optional
+// and the operator falls back to the values from Default().
+type Config struct {
+	// Settings for the namespace that's created for each of the workspaces.
+	Namespace NamespaceConfig `json:"namespace,omitempty"`
+
+	// Settings for the workspaces that expire.
+	Expiry ExpiryConfig `json:"expiry,omitempty"`
+
+	// Settings for the deployment of the components.
+	Deployment DeploymentConfig `json:"deployment,omitempty"`
+
+	// Settings for the ingresses of the components. Projects can
+	// override any of them.
+	Ingress spot.IngressSpec `json:"ingress,omitempty"`
+}
+
+type DeploymentConfig struct {
+	// ReadyTimeout is how long the components of a workspace have to become
+	// ready once they are deployed. The workspace errors out when one of
+	// them is still not ready after that. Defaults to 10 minutes.
+	ReadyTimeout meta.Duration `json:"readyTimeout,omitempty"`
+
+	// MaxResources is the most a component's container can request or
+	// be limited to. Containers that don't set a limit are limited to it and
+	// a workspace asking for more errors out. There's no ceiling if it's not set.
+	MaxResources core.ResourceList `json:"maxResources,omitempty"`
+
+	// ChartRepositories are the hosts the Helm charts can be downloaded from,
+	// ie. "charts.bitnami.com" or "*.example.com" for any of its subdomains.
+	// Charts are only downloaded over https and the components fetching
+	// their chart from a chart repository error out if it's not set.
+	ChartRepositories []string `json:"chartRepositories,omitempty"`
+
+	// Repositories are the hosts the branches of the workspaces can be
+	// resolved and fetched from, with the same syntax as ChartRepositories.
+	// Repositories are only fetched over https. Defaults to "github.com".
+	Repositories []string `json:"repositories,omitempty"`
+}
+
+type ExpiryConfig struct {
+	// WarningPeriod is how long before a workspace expires a warning
+	// event is emitted. Defaults to 1 hour.
+	WarningPeriod meta.Duration `json:"warningPeriod,omitempty"`
+}
+
+type NamespaceConfig struct {
+	// ResourceQuota applied to every managed namespace so a single workspace
+	// can't starve the cluster. No quota is applied if it's not set.
+	ResourceQuota *core.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+
+	// LimitRange applied to every managed namespace. This is where the
+	// default requests/limits of the containers should be configured as the
+	// ResourceQuota requires every container to have them set.
+	LimitRange *core.LimitRangeSpec `json:"limitRange,omitempty"`
+}
+
+func Default() *Config {
+	return &Config{
+		Expiry: ExpiryConfig{
+			WarningPeriod: meta.Duration{Duration: time.Hour},
+		},
+		Deployment: DeploymentConfig{
+			ReadyTimeout: meta.Duration{Duration: 10 * time.Minute},
+			Repositories: []string{"github.com"},
+		},
+		Ingress: spot.IngressSpec{
+			Host:      "{{ingress}}-{{workspace}}.{{domain}}",
+			Domain:    "localhost",
+			ClassName: "nginx",
+		},
+	}
+}
+
+// Load reads the configuration file at path. An empty path
+// returns the default configuration.
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	if len(path) == 0 {
+		return config, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -25,10 +25,10 @@ import (
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -81,43 +81,24 @@ func (r *BuildReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 
 		podReference := spot.NewPodReference(pod)
 		build.Status.Pod = &podReference
-		build.Status.Stage = spot.BuildStageRunning
+		build.SetStage(spot.BuildStageRunning, fmt.Sprintf("Building in %s", podReference.String()))
 		if err := r.Client.Status().Update(ctx, &build); err != nil {
 			logger.Info("Oops", "error", err)
 			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, err)
 		}
 
 	case spot.BuildStageDone:
-		// Let's update the status on the Workspace now that a build for that workspace is done.
-		var workspace spot.Workspace
-		var reference *meta.OwnerReference
-		for _, ref := range build.ObjectMeta.OwnerReferences {
-			if ref.Kind == "Workspace" {
-				reference = &ref
-				break
+		// The builder pod only sets the stage, the transition needs
+		// to be recorded along with the conditions.
+		if !apimeta.IsStatusConditionTrue(build.Status.Conditions, spot.BuildConditionSucceeded) {
+			build.SetStage(spot.BuildStageDone, fmt.Sprintf("Image pushed to %s", build.ImageURL()))
+			if err := r.Client.Status().Update(ctx, &build); err != nil {
+				return ctrl.Result{}, err
 			}
 		}
 
-		if reference == nil {
-			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, ErrStageWithInvalidState)
-		}
-
-		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: build.Namespace, Name: reference.Name}, &workspace); err != nil {
-			return ctrl.Result{Requeue: false}, r.markBuildHasErrored(ctx, &build, err)
-		}
-
-		if workspace.Status.Images == nil {
-			// This build is the first to add an entry, make the map
-			workspace.Status.Images = make(map[string]spot.BuildImage)
-		}
-
-		// Update workspace with the Image from the build
-		workspace.Status.Images[fmt.Sprintf("%s:%s", build.ImageURL(), r.tagFor(&build))] = *build.Status.Image
-		if err := r.Client.SubResource("status").Update(ctx, &workspace); err != nil {
-			// Can't update the workspace with this build's information.
-			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, err)
-		}
-
+		// The workspace owns this build and tracks its progress, the only thing left
+		// to do is some housekeeping.
 		var pod core.Pod
 		if err := r.Client.Get(ctx, build.Status.Pod.NamespacedName(), &pod); err != nil {
 			if k8sErrors.IsNotFound(err) {
@@ -136,30 +117,9 @@ func (r *BuildReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		}
 
 	case spot.BuildStageError:
-		// A build error means the whole workspace can't progress further. Let's notify workspace and call it.
-		var workspace spot.Workspace
-		var reference *meta.OwnerReference
-		for _, ref := range build.ObjectMeta.OwnerReferences {
-			if ref.Kind == "Workspace" {
-				reference = &ref
-				break
-			}
-		}
-
-		if reference == nil {
-			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, ErrStageWithInvalidState)
-		}
-
-		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: build.Namespace, Name: reference.Name}, &workspace); err != nil {
-			return ctrl.Result{Requeue: false}, r.markBuildHasErrored(ctx, &build, err)
-		}
-
-		// TODO: Workspace CRD should watch for builds and should update
-		// its own stage.
-		workspace.Status.Stage = spot.WorkspaceStageError
-		if err := r.Client.SubResource("status").Update(ctx, &workspace); err != nil {
-			logger.Error(err, "fatal error updating the workspace status")
-		}
+		// A build error means the whole workspace can't progress further. The workspace
+		// owns this build and will notice the error on its own.
+		r.EventRecorder.Event(&build, "Warning", string(build.Status.Stage), "Build failed")
 
 	default:
 		var pod core.Pod
@@ -203,6 +163,9 @@ func (r *BuildReconciler) buildPod(ctx context.Context, build *spot.Build) (*cor
 		ObjectMeta: meta.ObjectMeta{
 			Namespace:    "spot-system",
 			GenerateName: fmt.Sprintf("%s-", build.Name),
+			Labels: map[string]string{
+				spot.BuildLabel: build.Name,
+			},
 			Annotations: map[string]string{
 				"container.apparmor.security.beta.kubernetes.io/buildkit": "unconfined",
 				"container.seccomp.security.alpha.kubernetes.io/buildkit": "unconfined",
@@ -298,6 +261,6 @@ func (r *BuildReconciler) tagFor(build *spot.Build) string {
 func (r *BuildReconciler) markBuildHasErrored(ctx context.Context, build *spot.Build, err error) error {
 	logger := log.FromContext(ctx)
 	logger.Error(err, "Error happened with the build")
-	build.Status.Stage = spot.BuildStageError
+	build.SetStage(spot.BuildStageError, err.Error())
 	return r.Client.Status().Update(ctx, build)
 }
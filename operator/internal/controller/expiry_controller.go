@@ -0,0 +1,228 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"github.com/releasehub-com/spot/operator/internal/config"
+)
+
+// WorkspaceExpiryReconciler deletes the workspaces that had no
+// activity for longer than their TTL.
+type WorkspaceExpiryReconciler struct {
+	client.Client
+	Scheme        *runtime.Scheme
+	EventRecorder record.EventRecorder
+	Config        *config.Config
+}
+
+//+kubebuilder:rbac:groups=spot.release.com,resources=workspaces,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=spot.release.com,resources=workspaces/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=spot.release.com,resources=projects,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile records the last activity of the workspace and computes when it expires. A
+// warning event is emitted once the workspace enters the warning period and the workspace
+// is deleted when it expires. The teardown is then handled by the WorkspaceReconciler.
+//
+// Activity is either a new generation of the workspace or a newer timestamp
+// in the spot.LastActivityAnnotation that the receiver sets.
+func (r *WorkspaceExpiryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var workspace spot.Workspace
+	if err := r.Client.Get(ctx, req.NamespacedName, &workspace); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		logger.Error(err, "Couldn't retrieve the workspace", "NamespacedName", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+
+	if !workspace.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	ttl, err := r.ttl(ctx, &workspace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	original := workspace.Status.Expiry.DeepCopy()
+	now := metav1.Now()
+
+	if ttl == nil {
+		if workspace.Status.Expiry == nil || workspace.Status.Expiry.ExpiresAt == nil {
+			return ctrl.Result{}, nil
+		}
+
+		workspace.Status.Expiry.ExpiresAt = nil
+		workspace.Status.Expiry.WarnedAt = nil
+		return ctrl.Result{}, r.patchExpiry(ctx, &workspace)
+	}
+
+	expiry := recordActivity(&workspace, now)
+
+	if workspace.Annotations[spot.PinnedAnnotation] == "true" {
+		expiry.ExpiresAt = nil
+		expiry.WarnedAt = nil
+
+		if reflect.DeepEqual(original, expiry) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, r.patchExpiry(ctx, &workspace)
+	}
+
+	expiresAt := metav1.NewTime(expiry.LastActivityTime.Add(ttl.Duration))
+	expiry.ExpiresAt = &expiresAt
+
+	if !now.Before(&expiresAt) {
+		logger.Info("Workspace expired", "ExpiresAt", expiresAt)
+		r.EventRecorder.Event(&workspace, "Normal", "Expired", fmt.Sprintf("No activity since %s", expiry.LastActivityTime.Format(time.RFC3339)))
+
+		if err := r.Client.Delete(ctx, &workspace); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	// A warning is only sent once for each period of inactivity.
+	warnAt := expiresAt.Add(-r.Config.Expiry.WarningPeriod.Duration)
+	warned := expiry.WarnedAt != nil && !expiry.WarnedAt.Before(&expiry.LastActivityTime)
+
+	if !warned {
+		expiry.WarnedAt = nil
+
+		if !now.Time.Before(warnAt) {
+			r.EventRecorder.Event(&workspace, "Warning", "Expiring", fmt.Sprintf("Workspace expires at %s", expiresAt.Format(time.RFC3339)))
+			expiry.WarnedAt = &now
+			warned = true
+		}
+	}
+
+	if !reflect.DeepEqual(original, expiry) {
+		if err := r.patchExpiry(ctx, &workspace); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	next := expiresAt.Sub(now.Time)
+	if !warned {
+		next = warnAt.Sub(now.Time)
+	}
+
+	return ctrl.Result{RequeueAfter: next}, nil
+}
+
+// patchExpiry only writes the expiry of the workspace's status. It's patched without
+// checking the version of the workspace so it neither conflicts with nor overwrites
+// the status written by the WorkspaceReconciler in the meantime.
+func (r *WorkspaceExpiryReconciler) patchExpiry(ctx context.Context, workspace *spot.Workspace) error {
+	expiry := workspace.Status.Expiry
+
+	// The fields that are not set are sent as null so they are removed.
+	data, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"expiry": map[string]interface{}{
+				"lastActivityTime":   expiry.LastActivityTime,
+				"observedGeneration": expiry.ObservedGeneration,
+				"expiresAt":          expiry.ExpiresAt,
+				"warnedAt":           expiry.WarnedAt,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.Client.Status().Patch(ctx, workspace, client.RawPatch(types.MergePatchType, data))
+}
+
+// ttl returns the TTL of the workspace, falling back to the project's
+// default. A nil value means the workspace never expires.
+func (r *WorkspaceExpiryReconciler) ttl(ctx context.Context, workspace *spot.Workspace) (*metav1.Duration, error) {
+	if workspace.Spec.TTL != nil {
+		return workspace.Spec.TTL, nil
+	}
+
+	if len(workspace.Spec.Project.Name) == 0 {
+		return nil, nil
+	}
+
+	var project spot.Project
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: workspace.Namespace, Name: workspace.Spec.Project.Name}, &project); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return project.Spec.WorkspaceTTL, nil
+}
+
+// recordActivity updates the last activity of the workspace if its spec changed
+// or if the receiver reported a more recent activity.
+func recordActivity(workspace *spot.Workspace, now metav1.Time) *spot.ExpiryStatus {
+	expiry := workspace.Status.Expiry
+	if expiry == nil {
+		expiry = &spot.ExpiryStatus{
+			LastActivityTime:   workspace.CreationTimestamp,
+			ObservedGeneration: workspace.Generation,
+		}
+		workspace.Status.Expiry = expiry
+	}
+
+	if expiry.ObservedGeneration != workspace.Generation {
+		expiry.LastActivityTime = now
+		expiry.ObservedGeneration = workspace.Generation
+	}
+
+	if value, ok := workspace.Annotations[spot.LastActivityAnnotation]; ok {
+		if timestamp, err := time.Parse(time.RFC3339, value); err == nil && timestamp.After(expiry.LastActivityTime.Time) {
+			expiry.LastActivityTime = metav1.NewTime(timestamp)
+		}
+	}
+
+	return expiry
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkspaceExpiryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("workspace-expiry").
+		For(&spot.Workspace{}).
+		Complete(r)
+}
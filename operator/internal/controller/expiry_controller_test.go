@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+func TestRecordActivity(t *testing.T) {
+	created := time.Date(2023, time.May, 10, 8, 0, 0, 0, time.UTC)
+	recorded := created.Add(time.Hour)
+	now := metav1.NewTime(created.Add(3 * time.Hour))
+
+	tests := []struct {
+		name       string
+		generation int64
+		expiry     *spot.ExpiryStatus
+		annotation string
+		want       time.Time
+		observed   int64
+	}{
+		{
+			name:       "new workspace",
+			generation: 1,
+			want:       created,
+			observed:   1,
+		},
+		{
+			name:       "nothing changed",
+			generation: 2,
+			expiry:     &spot.ExpiryStatus{LastActivityTime: metav1.NewTime(recorded), ObservedGeneration: 2},
+			want:       recorded,
+			observed:   2,
+		},
+		{
+			name:       "spec changed",
+			generation: 3,
+			expiry:     &spot.ExpiryStatus{LastActivityTime: metav1.NewTime(recorded), ObservedGeneration: 2},
+			want:       now.Time,
+			observed:   3,
+		},
+		{
+			name:       "receiver reported a more recent activity",
+			generation: 2,
+			expiry:     &spot.ExpiryStatus{LastActivityTime: metav1.NewTime(recorded), ObservedGeneration: 2},
+			annotation: created.Add(2 * time.Hour).Format(time.RFC3339),
+			want:       created.Add(2 * time.Hour),
+			observed:   2,
+		},
+		{
+			name:       "receiver reported an older activity",
+			generation: 2,
+			expiry:     &spot.ExpiryStatus{LastActivityTime: metav1.NewTime(recorded), ObservedGeneration: 2},
+			annotation: created.Format(time.RFC3339),
+			want:       recorded,
+			observed:   2,
+		},
+		{
+			name:       "invalid annotation",
+			generation: 2,
+			expiry:     &spot.ExpiryStatus{LastActivityTime: metav1.NewTime(recorded), ObservedGeneration: 2},
+			annotation: "yesterday",
+			want:       recorded,
+			observed:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := &spot.Workspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Generation:        tt.generation,
+					CreationTimestamp: metav1.NewTime(created),
+				},
+				Status: spot.WorkspaceStatus{Expiry: tt.expiry},
+			}
+
+			if len(tt.annotation) != 0 {
+				workspace.Annotations = map[string]string{spot.LastActivityAnnotation: tt.annotation}
+			}
+
+			expiry := recordActivity(workspace, now)
+			if workspace.Status.Expiry != expiry {
+				t.Error("the expiry isn't recorded in the status")
+			}
+
+			if !expiry.LastActivityTime.Time.Equal(tt.want) {
+				t.Errorf("got the last activity at %s, want %s", expiry.LastActivityTime.Time, tt.want)
+			}
+
+			if expiry.ObservedGeneration != tt.observed {
+				t.Errorf("got the generation %d, want %d", expiry.ObservedGeneration, tt.observed)
+			}
+		})
+	}
+}
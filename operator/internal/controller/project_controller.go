@@ -18,17 +18,22 @@ package controller
 
 import (
 	"context"
-	"fmt"
-
-	core "k8s.io/api/core/v1"
+	"sort"
 
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"github.com/releasehub-com/spot/operator/internal/schedule"
 )
 
 // ProjectReconciler reconciles a Project object
@@ -41,35 +46,89 @@ type ProjectReconciler struct {
 //+kubebuilder:rbac:groups=spot.release.com,resources=projects/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=spot.release.com,resources=projects/finalizers,verbs=update
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the Project object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// Reconcile validates the Project's template and reports every workspace
+// that was instantiated from it.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.4/pkg/reconcile
 func (r *ProjectReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	logger := log.FromContext(ctx)
 
 	var project spot.Project
-	var configMap core.ConfigMap
-
 	if err := r.Client.Get(ctx, req.NamespacedName, &project); err != nil {
-		return ctrl.Result{Requeue: false}, err
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		logger.Error(err, "Couldn't retrieve the project", "NamespacedName", req.NamespacedName)
+		return ctrl.Result{}, err
+	}
+
+	condition := metav1.Condition{
+		Type:               spot.ProjectConditionValid,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: project.Generation,
+		Reason:             "TemplateValid",
+	}
+
+	if err := r.validate(&project); err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "TemplateInvalid"
+		condition.Message = err.Error()
+	}
+
+	apimeta.SetStatusCondition(&project.Status.Conditions, condition)
+
+	var workspaces spot.WorkspaceList
+	if err := r.Client.List(ctx, &workspaces, client.InNamespace(project.Namespace), client.MatchingLabels{spot.ProjectLabel: project.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	project.Status.Workspaces = nil
+	for _, workspace := range workspaces.Items {
+		project.Status.Workspaces = append(project.Status.Workspaces, spot.ProjectWorkspaceStatus{
+			Name:   workspace.Name,
+			Branch: workspace.Spec.Branch.Name,
+			Stage:  workspace.Status.Stage,
+		})
+	}
+
+	sort.Slice(project.Status.Workspaces, func(i, j int) bool {
+		return project.Status.Workspaces[i].Name < project.Status.Workspaces[j].Name
+	})
+
+	project.Status.ObservedGeneration = project.Generation
+
+	return ctrl.Result{}, r.Client.Status().Update(ctx, &project)
+}
+
+// validate checks the template along with the default sleep schedule
+// as both are used when a workspace is instantiated.
+func (r *ProjectReconciler) validate(project *spot.Project) error {
+	if err := project.Validate(); err != nil {
+		return err
 	}
 
-	if err := r.Client.Get(ctx, types.NamespacedName{Name: project.Name, Namespace: "spot-system"}, &configMap); err != nil {
-		fmt.Println("error finding the configmap for this project", err)
+	if project.Spec.Sleep != nil {
+		if _, err := schedule.Parse(project.Spec.Sleep); err != nil {
+			return err
+		}
 	}
 
-	return ctrl.Result{}, nil
+	return nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ProjectReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&spot.Project{}).
+		Watches(&source.Kind{Type: &spot.Workspace{}}, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
+			name, ok := object.GetLabels()[spot.ProjectLabel]
+			if !ok {
+				return nil
+			}
+
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: object.GetNamespace(), Name: name}}}
+		})).
 		Complete(r)
 }
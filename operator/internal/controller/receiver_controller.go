@@ -21,7 +21,8 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -33,12 +34,28 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/releasehub-com/spot/operator/internal/config"
+	"github.com/releasehub-com/spot/operator/internal/routing"
 )
 
+// Field manager of the receiver's objects. Like the objects of the workspaces,
+// they are applied with server-side apply and the operator owns every field it sets.
+const receiverFieldOwner = client.FieldOwner("spot")
+
+// The receiver's route sends every request to the webhooks.
+var receiverRoute = routing.Route{
+	Name:      "receiver",
+	Namespace: "spot-system",
+	Path:      "/",
+	Target:    routing.Target{Service: "receiver", Port: 3333},
+}
+
 // ReceiverReconciler reconciles a Receiver object
 type ReceiverReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	Config *config.Config
 }
 
 //+kubebuilder:rbac:groups=spot.release.com,resources=receivers,verbs=get;list;watch;create;update;patch;delete
@@ -65,7 +82,7 @@ func (r *ReceiverReconciler) Reconcile(ctx context.Context, req ctrlRuntime.Requ
 		return ctrlRuntime.Result{}, err
 	}
 
-	if err := r.reconcileIngress(ctx, service, deployment); err != nil {
+	if err := r.reconcileRoute(ctx, service, deployment); err != nil {
 		return ctrlRuntime.Result{}, err
 	}
 
@@ -73,148 +90,132 @@ func (r *ReceiverReconciler) Reconcile(ctx context.Context, req ctrlRuntime.Requ
 }
 
 func (r *ReceiverReconciler) reconcileService(ctx context.Context, _ *appsv1.Deployment) (*corev1.Service, error) {
-	logger := log.FromContext(ctx)
-	objectKey := client.ObjectKey{
-		Name:      "receiver",
-		Namespace: "spot-system",
-	}
-
-	var service corev1.Service
-
-	if err := r.Client.Get(ctx, objectKey, &service); err != nil {
-		logger.Info("service not present")
-
-		service = corev1.Service{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "receiver",
-				Namespace: "spot-system",
+	service := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "receiver",
+			Namespace: "spot-system",
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{
+				"spot.release.com/pods": "receiver",
 			},
-			Spec: corev1.ServiceSpec{
-				Selector: map[string]string{
-					"spot.release.com/pods": "receiver",
-				},
-				Ports: []corev1.ServicePort{{
-					Protocol:   corev1.ProtocolTCP,
-					Port:       3333,
-					TargetPort: intstr.FromInt(3333),
-				}},
-			},
-		}
-
-		err = r.Client.Create(ctx, &service)
+			Ports: []corev1.ServicePort{{
+				Name:       "receiver",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       3333,
+				TargetPort: intstr.FromInt(3333),
+			}, {
+				// Sleeping workspaces are routed to the proxy so
+				// a request can wake them up.
+				Name:       "proxy",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       3334,
+				TargetPort: intstr.FromInt(3334),
+			}},
+		},
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	if err := r.Client.Patch(ctx, service, client.Apply, receiverFieldOwner, client.ForceOwnership); err != nil {
+		return nil, err
 	}
 
-	return &service, nil
+	return service, nil
 }
 
-func (r *ReceiverReconciler) reconcileIngress(ctx context.Context, _ *corev1.Service, deployment *appsv1.Deployment) error {
+// reconcileRoute exposes the receiver with the routing backend of the
+// operator's configuration so webhooks can reach it. The receiver's
+// route of the other backends is removed when the backend changes.
+func (r *ReceiverReconciler) reconcileRoute(ctx context.Context, _ *corev1.Service, _ *appsv1.Deployment) error {
 	logger := log.FromContext(ctx)
-	objectKey := client.ObjectKey{
-		Name:      "receiver",
-		Namespace: "spot-system",
+
+	backend, err := routing.New(r.Config.Ingress)
+	if err != nil {
+		return err
 	}
 
-	if err := r.Client.Get(ctx, objectKey, &networkingv1.Ingress{}); err != nil {
-		logger.Info("ingress not present")
+	route := backend.Object(receiverRoute)
+	if err := r.Client.Patch(ctx, route, client.Apply, receiverFieldOwner, client.ForceOwnership); err != nil {
+		return err
+	}
 
-		ingressClassName := "nginx"
-		pathType := networkingv1.PathTypePrefix
+	for _, other := range routing.All(r.Config.Ingress) {
+		if other.Kind() == backend.Kind() {
+			continue
+		}
 
-		ingress := &networkingv1.Ingress{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "receiver",
-				Namespace: "spot-system",
-			},
-			Spec: networkingv1.IngressSpec{
-				IngressClassName: &ingressClassName,
-				Rules: []networkingv1.IngressRule{{
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{{
-								Path:     "/",
-								PathType: &pathType,
-								Backend: networkingv1.IngressBackend{
-									Service: &networkingv1.IngressServiceBackend{
-										Name: "receiver",
-										Port: networkingv1.ServiceBackendPort{Number: 3333},
-									},
-								},
-							}},
-						},
-					},
-				}},
-			},
+		err := r.Client.Delete(ctx, other.Object(receiverRoute))
+		if err == nil {
+			logger.Info("removed the receiver's route", "kind", other.Kind())
+			continue
 		}
 
-		return r.Client.Create(ctx, ingress)
+		// The Gateway API might not be installed in the cluster.
+		if !errors.IsNotFound(err) && !apimeta.IsNoMatchError(err) {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (r *ReceiverReconciler) reconcileDeployment(ctx context.Context) (*appsv1.Deployment, error) {
-	logger := log.FromContext(ctx)
-
-	var deployment appsv1.Deployment
-
-	objectKey := client.ObjectKey{
-		Name:      "receiver",
-		Namespace: "spot-system",
+func (r *ReceiverReconciler) route() (client.Object, error) {
+	backend, err := routing.New(r.Config.Ingress)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := r.Client.Get(ctx, objectKey, &deployment); err != nil {
-		logger.Info("deployment not present")
-
-		var replicaCount int32 = 1
-
-		//"public.ecr.aws/releasehub-com/receiver:latest"
+	return backend.Object(receiverRoute), nil
+}
 
-		deployment = appsv1.Deployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "receiver",
-				Namespace: "spot-system",
+func (r *ReceiverReconciler) reconcileDeployment(ctx context.Context) (*appsv1.Deployment, error) {
+	var replicaCount int32 = 1
+
+	//"public.ecr.aws/releasehub-com/receiver:latest"
+
+	deployment := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "receiver",
+			Namespace: "spot-system",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicaCount,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"spot.release.com/pods": "receiver",
+				},
 			},
-			Spec: appsv1.DeploymentSpec{
-				Replicas: &replicaCount,
-				Selector: &metav1.LabelSelector{
-					MatchLabels: map[string]string{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
 						"spot.release.com/pods": "receiver",
 					},
 				},
-				Template: corev1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels: map[string]string{
-							"spot.release.com/pods": "receiver",
-						},
-					},
-					Spec: corev1.PodSpec{
-						ServiceAccountName: "spot-controller-manager", // TODO: Most likely to change spot-system/default to support the RBAC settings we need instead
-						Containers: []corev1.Container{{
-							Image:           "receiver:latest",
-							ImagePullPolicy: corev1.PullNever,
-							Name:            "receiver",
-							Ports: []corev1.ContainerPort{{
-								ContainerPort: 3333,
-								Name:          "receiver-port",
-							}},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "spot-controller-manager", // TODO: Most likely to change spot-system/default to support the RBAC settings we need instead
+					Containers: []corev1.Container{{
+						Image:           "receiver:latest",
+						ImagePullPolicy: corev1.PullNever,
+						Name:            "receiver",
+						Ports: []corev1.ContainerPort{{
+							ContainerPort: 3333,
+							Name:          "receiver-port",
+						}, {
+							ContainerPort: 3334,
+							Name:          "proxy-port",
 						}},
-					},
+					}},
 				},
 			},
-		}
-
-		err = r.Client.Create(ctx, &deployment)
+		},
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	if err := r.Client.Patch(ctx, deployment, client.Apply, receiverFieldOwner, client.ForceOwnership); err != nil {
+		return nil, err
 	}
 
-	return &deployment, nil
+	return deployment, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -225,19 +226,22 @@ func (r *ReceiverReconciler) SetupWithManager(mgr ctrlRuntime.Manager) error {
 		return err
 	}
 
-	// Always need to make sure that we have a deployment fully configured to
-	// receive webhooks.
-	err = ctrl.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForObject{}, predicate.NewPredicateFuncs(func(obj client.Object) bool {
-		return obj.GetName() == "receiver" && obj.GetNamespace() == "spot-system"
-	}))
+	route, err := r.route()
+	if err != nil {
+		return err
+	}
 
-	err = ctrl.Watch(&source.Kind{Type: &networkingv1.Ingress{}}, &handler.EnqueueRequestForObject{}, predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	isReceiver := predicate.NewPredicateFuncs(func(obj client.Object) bool {
 		return obj.GetName() == "receiver" && obj.GetNamespace() == "spot-system"
-	}))
+	})
 
-	err = ctrl.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForObject{}, predicate.NewPredicateFuncs(func(obj client.Object) bool {
-		return obj.GetName() == "receiver" && obj.GetNamespace() == "spot-system"
-	}))
+	// Always need to make sure that we have a deployment fully configured to
+	// receive webhooks, along with its service and its route.
+	for _, object := range []client.Object{&appsv1.Deployment{}, &corev1.Service{}, route} {
+		if err := ctrl.Watch(&source.Kind{Type: object}, &handler.EnqueueRequestForObject{}, isReceiver); err != nil {
+			return err
+		}
+	}
 
-	return err
+	return nil
 }
@@ -18,29 +18,66 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"github.com/releasehub-com/spot/operator/internal/config"
+	"github.com/releasehub-com/spot/operator/internal/repository"
+	"github.com/releasehub-com/spot/operator/internal/schedule"
 	"github.com/releasehub-com/spot/operator/internal/stages"
 )
 
+// How often a workspace with components waiting on
+// their dependencies is reconciled.
+const dependencyPollInterval = 5 * time.Second
+
+// How often the replicas of a running workspace with
+// autoscaled components are recorded in its status.
+const replicasPollInterval = 30 * time.Second
+
+// How often a terminating workspace checks whether
+// the objects it removed are gone.
+const teardownPollInterval = 5 * time.Second
+
 // WorkspaceReconciler reconciles a Workspace object
 type WorkspaceReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	record.EventRecorder
+	Config *config.Config
+
+	// Checkouts of the repositories the components are rendered from,
+	// kept across the reconciliations of the workspaces.
+	checkouts repository.Cache
 }
 
 //+kubebuilder:rbac:groups=spot.release.com,resources=workspaces,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=spot.release.com,resources=workspaces/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=spot.release.com,resources=workspaces/finalizers,verbs=update
 //+kubebuilder:rbac:groups=spot.release.com,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=pods;services,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=core,resources=namespaces;resourcequotas;limitranges,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get;update;patch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=core,resources=configmaps;secrets;serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments/scale;statefulsets/scale,verbs=get;update;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=referencegrants,verbs=get;list;watch;create;delete
 
 func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -54,13 +91,46 @@ func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
+	// The Workspace is being deleted, everything that was created for it
+	// needs to be removed before the finalizer is released.
+	if !workspace.DeletionTimestamp.IsZero() {
+		return r.teardown(ctx, &workspace)
+	}
+
+	if !controllerutil.ContainsFinalizer(&workspace, spot.WorkspaceFinalizer) {
+		controllerutil.AddFinalizer(&workspace, spot.WorkspaceFinalizer)
+		return ctrl.Result{}, r.Client.Update(ctx, &workspace)
+	}
+
+	if len(workspace.Spec.Project.Name) != 0 && workspace.Labels[spot.ProjectLabel] != workspace.Spec.Project.Name {
+		if workspace.Labels == nil {
+			workspace.Labels = make(map[string]string)
+		}
+
+		workspace.Labels[spot.ProjectLabel] = workspace.Spec.Project.Name
+		return ctrl.Result{}, r.Client.Update(ctx, &workspace)
+	}
+
 	switch workspace.Status.Stage {
 
 	// The Workspace was just created and nothing has happened to it
 	// yet. The first step is to start the building process.
 	case spot.WorkspaceStageInitialized:
+		// A workspace of a project is instantiated from the project's template. The spec
+		// is updated and the workspace will be reconciled again with it.
+		if len(workspace.Spec.Project.Name) != 0 {
+			if updated, err := r.instantiate(ctx, &workspace); err != nil || updated {
+				return ctrl.Result{}, err
+			}
+		}
+
 		r.EventRecorder.Event(&workspace, "Normal", "Initialized", "Workspace initialized")
-		builder := stages.Builder{Client: r.Client}
+		namespace := stages.Namespace{Client: r.Client, Config: r.Config.Namespace}
+		if err := namespace.Start(ctx, &workspace); err != nil {
+			return ctrl.Result{}, r.markWorkspaceHasErrored(ctx, &workspace, err)
+		}
+
+		builder := r.builder()
 		err := builder.Start(ctx, &workspace)
 		if err != nil {
 			return ctrl.Result{}, r.markWorkspaceHasErrored(ctx, &workspace, err)
@@ -71,19 +141,160 @@ func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	// to see if they are completed and we can move forward to the next
 	// stage
 	case spot.WorkspaceStageBuilding:
-		r.EventRecorder.Event(&workspace, "Normal", "Building", "Waiting for builds to complete")
-		builder := stages.Builder{Client: r.Client}
-		err := builder.Update(ctx, &workspace)
-		if err != nil {
+		builder := r.builder()
+		if err := builder.Update(ctx, &workspace); err != nil {
 			return ctrl.Result{}, err
 		}
 
 	case spot.WorkspaceStageDeploying:
-		r.EventRecorder.Event(&workspace, "Normal", "Deploying", "Deploying services and updating routes")
-		deployment := stages.Deployment{Client: r.Client}
+		if len(workspace.Status.Components) == 0 {
+			r.EventRecorder.Event(&workspace, "Normal", "Deploying", "Deploying services and updating routes")
+		}
+
+		deployment, err := r.deployment(ctx, &workspace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
 		if err := deployment.Start(ctx, &workspace); err != nil {
 			return ctrl.Result{}, err
 		}
+
+		// Some components are waiting on their dependencies or are not ready yet.
+		if workspace.Status.Stage == spot.WorkspaceStageDeploying {
+			return ctrl.Result{RequeueAfter: dependencyPollInterval}, nil
+		}
+
+	// The Workspace is running. It moves forward when its spec changes or
+	// when its sleep schedule says it's time to go to sleep.
+	case spot.WorkspaceStageRunning:
+		window, err := r.sleepSchedule(ctx, &workspace)
+		if err != nil {
+			return ctrl.Result{}, r.markWorkspaceHasErrored(ctx, &workspace, err)
+		}
+
+		now := time.Now()
+		requeueAfter := window.Until(now)
+		sleep := stages.Sleep{Client: r.Client}
+
+		if window != nil && window.Asleep(now) {
+			idleFor := now.Sub(lastRequest(&workspace))
+			if workspace.Status.WokenAt == nil || idleFor >= window.IdleTimeout {
+				r.EventRecorder.Event(&workspace, "Normal", "Sleeping", "Scaling down the components until the workspace wakes up")
+				if err := sleep.Start(ctx, &workspace); err != nil {
+					return ctrl.Result{}, err
+				}
+
+				return ctrl.Result{RequeueAfter: requeueAfter}, nil
+			}
+
+			// The workspace was woken up by a request and goes back
+			// to sleep once it's idle.
+			if remaining := window.IdleTimeout - idleFor; remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+		} else if workspace.Status.WokenAt != nil {
+			r.EventRecorder.Event(&workspace, "Normal", "Waking", "Sleep schedule ended, routing the traffic back to the components")
+			if err := sleep.Resume(ctx, &workspace); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+
+		if workspace.Generation == workspace.Status.ObservedGeneration {
+			if !autoscaled(&workspace) {
+				return ctrl.Result{RequeueAfter: requeueAfter}, nil
+			}
+
+			deployment, err := r.deployment(ctx, &workspace)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if err := deployment.Refresh(ctx, &workspace); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if requeueAfter == 0 || replicasPollInterval < requeueAfter {
+				requeueAfter = replicasPollInterval
+			}
+
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+
+		r.EventRecorder.Event(&workspace, "Normal", "Updating", "Spec changed, rebuilding the components that changed")
+		builder := r.builder()
+		if err := builder.Rebuild(ctx, &workspace); err != nil {
+			return ctrl.Result{}, r.markWorkspaceHasErrored(ctx, &workspace, err)
+		}
+
+	// The components of the Workspace are scaled down until the schedule
+	// says it's time to wake up or until a request comes in for it.
+	case spot.WorkspaceStageSleeping:
+		window, err := r.sleepSchedule(ctx, &workspace)
+		if err != nil {
+			return ctrl.Result{}, r.markWorkspaceHasErrored(ctx, &workspace, err)
+		}
+
+		now := time.Now()
+		sleep := stages.Sleep{Client: r.Client}
+
+		if window != nil && window.Asleep(now) {
+			if !wakeRequested(&workspace) {
+				return ctrl.Result{RequeueAfter: window.Until(now)}, nil
+			}
+
+			r.EventRecorder.Event(&workspace, "Normal", "Waking", "A request came in, restoring the components of the workspace")
+			if err := sleep.WakeOnRequest(ctx, &workspace); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			return ctrl.Result{RequeueAfter: window.IdleTimeout}, nil
+		}
+
+		r.EventRecorder.Event(&workspace, "Normal", "Waking", "Restoring the components of the workspace")
+		if err := sleep.Wake(ctx, &workspace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: window.Until(now)}, nil
+
+	// The Workspace errored and stays in this stage until the retry
+	// annotation is set to a new value.
+	case spot.WorkspaceStageError:
+		retry := workspace.Annotations[spot.RetryAnnotation]
+		if len(retry) == 0 || retry == workspace.Status.LastRetry {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, r.retry(ctx, &workspace, retry)
+
+	// The Workspace is waiting on the builds of the components that changed. Once
+	// they are all completed, only the affected components are rolled out.
+	case spot.WorkspaceStageUpdating:
+		builder := r.builder()
+		if err := builder.Update(ctx, &workspace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if workspace.Status.Stage != spot.WorkspaceStageUpdating || !builder.Completed(&workspace) {
+			return ctrl.Result{}, nil
+		}
+
+		r.EventRecorder.Event(&workspace, "Normal", "Updating", "Rolling out the components that changed")
+		deployment, err := r.deployment(ctx, &workspace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := deployment.Update(ctx, &workspace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if workspace.Status.Stage == spot.WorkspaceStageUpdating {
+			return ctrl.Result{RequeueAfter: dependencyPollInterval}, nil
+		}
 	}
 
 	return ctrl.Result{}, nil
@@ -93,11 +304,243 @@ func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 func (r *WorkspaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&spot.Workspace{}).
+		Owns(&spot.Build{}).
 		Complete(r)
 }
 
+// retry resumes the workspace from the stage it failed in. Builds are only replaced
+// when they errored, the images that were already built are kept.
+func (r *WorkspaceReconciler) retry(ctx context.Context, workspace *spot.Workspace, retry string) error {
+	stage := workspace.Status.FailedStage
+
+	workspace.Status.RetryCount++
+	workspace.Status.LastRetry = retry
+
+	r.EventRecorder.Event(workspace, "Normal", "Retrying", fmt.Sprintf("Retry #%d, resuming from the %s stage", workspace.Status.RetryCount, stageName(stage)))
+
+	switch {
+	case stage == spot.WorkspaceStageBuilding || stage == spot.WorkspaceStageUpdating:
+		builder := r.builder()
+		if err := builder.Retry(ctx, workspace); err != nil {
+			return r.markWorkspaceHasErrored(ctx, workspace, err)
+		}
+
+		return nil
+
+	case stage == spot.WorkspaceStageDeploying:
+		deployment, err := r.deployment(ctx, workspace)
+		if err != nil {
+			return err
+		}
+
+		if err := deployment.Retry(ctx, workspace); err != nil {
+			return r.markWorkspaceHasErrored(ctx, workspace, err)
+		}
+
+		return nil
+
+	// A workspace that failed while being initialized might have created some
+	// of its builds already, those are reused.
+	case stage == spot.WorkspaceStageInitialized && len(workspace.Status.Builds) != 0:
+		workspace.Status.FailedStage = spot.WorkspaceStageBuilding
+		builder := r.builder()
+		if err := builder.Retry(ctx, workspace); err != nil {
+			return r.markWorkspaceHasErrored(ctx, workspace, err)
+		}
+
+		return nil
+	}
+
+	workspace.SetStage(stage, "")
+	return r.Client.Status().Update(ctx, workspace)
+}
+
+func stageName(stage spot.WorkspaceStage) string {
+	if stage == spot.WorkspaceStageInitialized {
+		return "Initialized"
+	}
+
+	return string(stage)
+}
+
+// project returns the project of the workspace. An empty project is
+// returned when the workspace doesn't have one or when it doesn't exist.
+func (r *WorkspaceReconciler) project(ctx context.Context, workspace *spot.Workspace) (*spot.Project, error) {
+	var project spot.Project
+	if len(workspace.Spec.Project.Name) == 0 {
+		return &project, nil
+	}
+
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: workspace.Namespace, Name: workspace.Spec.Project.Name}, &project); err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
+// builder returns the Builder stage configured for the operator.
+func (r *WorkspaceReconciler) builder() *stages.Builder {
+	return &stages.Builder{Client: r.Client, Repositories: r.Config.Deployment.Repositories}
+}
+
+// deployment returns the Deployment stage configured for the workspace.
+func (r *WorkspaceReconciler) deployment(ctx context.Context, workspace *spot.Workspace) (*stages.Deployment, error) {
+	project, err := r.project(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stages.Deployment{
+		Client:       r.Client,
+		ReadyTimeout: r.Config.Deployment.ReadyTimeout.Duration,
+		Ingress:      r.Config.Ingress.Merge(project.Spec.Ingress),
+		Defaults:     project.Spec.ComponentDefaults,
+		MaxResources: r.Config.Deployment.MaxResources,
+
+		ChartRepositories: r.Config.Deployment.ChartRepositories,
+		Repositories:      r.Config.Deployment.Repositories,
+		Checkouts:         &r.checkouts,
+	}, nil
+}
+
+// sleepSchedule returns the sleep schedule of the workspace, falling back
+// to the project's. A nil window means the workspace never sleeps.
+func (r *WorkspaceReconciler) sleepSchedule(ctx context.Context, workspace *spot.Workspace) (*schedule.Window, error) {
+	spec := workspace.Spec.Sleep
+
+	if spec == nil {
+		project, err := r.project(ctx, workspace)
+		if err != nil {
+			return nil, err
+		}
+
+		spec = project.Spec.Sleep
+	}
+
+	if spec == nil {
+		return nil, nil
+	}
+
+	return schedule.Parse(spec)
+}
+
+// wakeRequested returns true when the receiver asked for the
+// workspace to wake up after it went to sleep.
+func wakeRequested(workspace *spot.Workspace) bool {
+	requestedAt, err := time.Parse(time.RFC3339, workspace.Annotations[spot.WakeRequestedAnnotation])
+	if err != nil || workspace.Status.StageTransitionTime == nil {
+		return false
+	}
+
+	return !requestedAt.Before(workspace.Status.StageTransitionTime.Time)
+}
+
+// lastRequest returns the last time the receiver proxied a request to a workspace
+// that was woken up. Waking up counts as a request.
+func lastRequest(workspace *spot.Workspace) time.Time {
+	var last time.Time
+	if workspace.Status.WokenAt != nil {
+		last = workspace.Status.WokenAt.Time
+	}
+
+	if requestedAt, err := time.Parse(time.RFC3339, workspace.Annotations[spot.LastRequestAnnotation]); err == nil && requestedAt.After(last) {
+		last = requestedAt
+	}
+
+	return last
+}
+
+// instantiate renders the project's template into the workspace's spec. It returns
+// true when the workspace doesn't move forward, either because its spec was updated
+// or because it errored. Rendering a spec that was already rendered doesn't change it.
+func (r *WorkspaceReconciler) instantiate(ctx context.Context, workspace *spot.Workspace) (bool, error) {
+	var project spot.Project
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: workspace.Namespace, Name: workspace.Spec.Project.Name}, &project); err != nil {
+		if errors.IsNotFound(err) {
+			// The project might not exist yet, let's try again later.
+			r.EventRecorder.Event(workspace, "Warning", "Initialized", fmt.Sprintf("Project %s not found", workspace.Spec.Project.Name))
+		}
+
+		return true, err
+	}
+
+	if err := project.Validate(); err != nil {
+		return true, r.markWorkspaceHasErrored(ctx, workspace, fmt.Errorf("project %s is invalid: %w", project.Name, err))
+	}
+
+	spec := workspace.Spec.DeepCopy()
+	if err := project.Render(spec); err != nil {
+		return true, r.markWorkspaceHasErrored(ctx, workspace, err)
+	}
+
+	// The subset of components might leave out some of the dependencies.
+	if err := spec.Validate(); err != nil {
+		return true, r.markWorkspaceHasErrored(ctx, workspace, err)
+	}
+
+	if len(spec.Components) == 0 {
+		return true, r.markWorkspaceHasErrored(ctx, workspace, fmt.Errorf("project %s doesn't have any component", project.Name))
+	}
+
+	if equality.Semantic.DeepEqual(spec, &workspace.Spec) {
+		return false, nil
+	}
+
+	workspace.Spec = *spec
+	r.EventRecorder.Event(workspace, "Normal", "Initialized", fmt.Sprintf("Instantiated from project %s", project.Name))
+
+	return true, r.Client.Update(ctx, workspace)
+}
+
+// teardown moves the workspace to the Terminating stage and removes all the objects
+// associated with it. The finalizer is only released once the workspace
+// reached the Deleted stage.
+func (r *WorkspaceReconciler) teardown(ctx context.Context, workspace *spot.Workspace) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(workspace, spot.WorkspaceFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	switch workspace.Status.Stage {
+	case spot.WorkspaceStageDeleted:
+		// Nothing left to do, the object can be released.
+		controllerutil.RemoveFinalizer(workspace, spot.WorkspaceFinalizer)
+		return ctrl.Result{}, r.Client.Update(ctx, workspace)
+
+	case spot.WorkspaceStageTerminating:
+		teardown := stages.Teardown{Client: r.Client}
+		if err := teardown.Start(ctx, workspace); err != nil {
+			r.EventRecorder.Event(workspace, "Warning", string(spot.WorkspaceStageTerminating), err.Error())
+			return ctrl.Result{}, err
+		}
+
+		// Some objects are still being removed.
+		if workspace.Status.Stage == spot.WorkspaceStageTerminating {
+			return ctrl.Result{RequeueAfter: teardownPollInterval}, nil
+		}
+
+		r.EventRecorder.Event(workspace, "Normal", string(spot.WorkspaceStageDeleted), fmt.Sprintf("Removed %d objects", len(workspace.Status.Removed)))
+		return ctrl.Result{}, nil
+
+	default:
+		r.EventRecorder.Event(workspace, "Normal", string(spot.WorkspaceStageTerminating), "Tearing down the workspace")
+		workspace.SetStage(spot.WorkspaceStageTerminating, "Tearing down the workspace")
+		return ctrl.Result{}, r.Client.Status().Update(ctx, workspace)
+	}
+}
+
 func (r *WorkspaceReconciler) markWorkspaceHasErrored(ctx context.Context, workspace *spot.Workspace, err error) error {
 	r.EventRecorder.Event(workspace, "Warning", string(spot.WorkspaceStageError), err.Error())
-	workspace.Status.Stage = spot.WorkspaceStageError
+	workspace.SetStage(spot.WorkspaceStageError, err.Error())
 	return r.Client.Status().Update(ctx, workspace)
 }
+
+// autoscaled returns true when one of the workspace's components autoscales.
+func autoscaled(workspace *spot.Workspace) bool {
+	for _, component := range workspace.Spec.Components {
+		if component.Autoscaling != nil {
+			return true
+		}
+	}
+
+	return false
+}
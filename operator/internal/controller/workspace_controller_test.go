@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"github.com/releasehub-com/spot/operator/internal/config"
+)
+
+// The specs drive the reconciler by hand as there are no controllers in the test
+// environment: the rollouts of the Deployments are completed by the specs and
+// the namespaces are never actually removed, so each spec gets its own.
+var _ = Describe("Workspace controller", func() {
+	var (
+		ctx        context.Context
+		reconciler *WorkspaceReconciler
+		workspace  *spot.Workspace
+	)
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(workspace)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(workspace), workspace)).To(Succeed())
+	}
+
+	deployment := func() *apps.Deployment {
+		var deployment apps.Deployment
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: workspace.Status.Namespace, Name: "web"}, &deployment)).To(Succeed())
+		return &deployment
+	}
+
+	// completeRollout reports the Deployment's pods as updated and available
+	// like the Deployment controller would.
+	completeRollout := func() {
+		d := deployment()
+		replicas := *d.Spec.Replicas
+		d.Status = apps.DeploymentStatus{
+			ObservedGeneration: d.Generation,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			ReadyReplicas:      replicas,
+			AvailableReplicas:  replicas,
+		}
+
+		Expect(k8sClient.Status().Update(ctx, d)).To(Succeed())
+	}
+
+	// deploy brings the workspace to the Deploying stage, its Deployment is
+	// created but not ready yet.
+	deploy := func() {
+		Expect(k8sClient.Create(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Finalizers).To(ContainElement(spot.WorkspaceFinalizer))
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageBuilding))
+		Expect(workspace.Status.Namespace).NotTo(BeEmpty())
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageDeploying))
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageDeploying))
+		Expect(deployment().Spec.Template.Spec.Containers[0].Image).To(Equal("nginx"))
+	}
+
+	run := func() {
+		deploy()
+		completeRollout()
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageRunning))
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		reconciler = &WorkspaceReconciler{
+			Client:        k8sClient,
+			Scheme:        k8sClient.Scheme(),
+			EventRecorder: record.NewFakeRecorder(100),
+			Config:        config.Default(),
+		}
+
+		namespace := &core.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "workspaces-"}}
+		Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+		tag := "main"
+		workspace = &spot.Workspace{
+			ObjectMeta: metav1.ObjectMeta{Name: "workspace", Namespace: namespace.Name},
+			Spec: spot.WorkspaceSpec{
+				Branch:     spot.BranchSpec{Name: "main"},
+				Tag:        &tag,
+				Components: []spot.ComponentSpec{{Name: "web", Image: spot.ImageSpec{Name: "nginx"}}},
+			},
+		}
+	})
+
+	It("deploys the components and runs once they are ready", func() {
+		run()
+		Expect(workspace.Status.ObservedGeneration).To(Equal(workspace.Generation))
+	})
+
+	It("rolls out the components that changed and waits for them before running again", func() {
+		run()
+
+		tag := "1.25"
+		workspace.Spec.Components[0].Image.Tag = &tag
+		Expect(k8sClient.Update(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageUpdating))
+		Expect(workspace.Status.ObservedGeneration).To(Equal(workspace.Generation))
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageUpdating))
+		Expect(deployment().Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+
+		completeRollout()
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageRunning))
+	})
+
+	It("scales the workloads down while sleeping and restores them on a request", func() {
+		run()
+
+		// Asleep for the whole year, except for a minute every minute.
+		workspace.Spec.Sleep = &spot.SleepSchedule{Sleep: "0 0 1 1 *", Wake: "* * * * *"}
+		Expect(k8sClient.Update(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageSleeping))
+		Expect(*deployment().Spec.Replicas).To(BeZero())
+		Expect(deployment().Annotations).To(HaveKeyWithValue("spot.release.com/replicas-before-sleep", "1"))
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageSleeping))
+
+		workspace.Annotations = map[string]string{spot.WakeRequestedAnnotation: time.Now().Format(time.RFC3339)}
+		Expect(k8sClient.Update(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageRunning))
+		Expect(workspace.Status.WokenAt).NotTo(BeNil())
+		Expect(*deployment().Spec.Replicas).To(BeEquivalentTo(1))
+		Expect(deployment().Annotations).NotTo(HaveKey("spot.release.com/replicas-before-sleep"))
+	})
+
+	It("retries from the stage it errored in once the retry annotation changes", func() {
+		workspace.Spec.Tag = nil
+		Expect(k8sClient.Create(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageError))
+		Expect(workspace.Status.FailedStage).To(Equal(spot.WorkspaceStageInitialized))
+
+		workspace.Annotations = map[string]string{spot.RetryAnnotation: "1"}
+		Expect(k8sClient.Update(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageInitialized))
+		Expect(workspace.Status.RetryCount).To(Equal(1))
+		Expect(workspace.Status.LastRetry).To(Equal("1"))
+
+		// Still missing its tag.
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageError))
+
+		// The same annotation doesn't retry again.
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageError))
+		Expect(workspace.Status.RetryCount).To(Equal(1))
+
+		tag := "main"
+		workspace.Spec.Tag = &tag
+		workspace.Annotations[spot.RetryAnnotation] = "2"
+		Expect(k8sClient.Update(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Status.RetryCount).To(Equal(2))
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageBuilding))
+	})
+
+	It("tears down the builds, the routes, the workloads and then the namespace", func() {
+		deploy()
+
+		build := &spot.Build{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "build-",
+				Namespace:    workspace.Namespace,
+				Labels:       map[string]string{spot.WorkspaceLabel: workspace.Name},
+			},
+			Spec: spot.BuildSpec{DefaultImageTag: "main", Image: spot.ImageSpec{Name: "web"}},
+		}
+		Expect(k8sClient.Create(ctx, build)).To(Succeed())
+
+		pathType := networking.PathTypePrefix
+		ingress := &networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: workspace.Status.Namespace,
+				Labels:    map[string]string{spot.WorkspaceLabel: workspace.Name},
+			},
+			Spec: networking.IngressSpec{
+				Rules: []networking.IngressRule{{
+					Host: "web.example.com",
+					IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+						Paths: []networking.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networking.IngressBackend{Service: &networking.IngressServiceBackend{
+								Name: "web",
+								Port: networking.ServiceBackendPort{Number: 80},
+							}},
+						}},
+					}},
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, ingress)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, workspace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageTerminating))
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageTerminating))
+
+		var kinds []string
+		for _, reference := range workspace.Status.Removed {
+			kinds = append(kinds, reference.Kind)
+		}
+
+		Expect(kinds).To(Equal([]string{"Build", "Ingress", "Deployment", "Namespace"}))
+
+		// The namespace is still terminating, the workspace waits on it.
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageTerminating))
+		Expect(workspace.Status.Removed).To(HaveLen(4))
+
+		// Finalize the namespace like the namespace controller would.
+		namespace := &core.Namespace{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: workspace.Status.Namespace}, namespace)).To(Succeed())
+		Expect(namespace.DeletionTimestamp).NotTo(BeNil())
+		namespace.Spec.Finalizers = nil
+		Expect(k8sClient.SubResource("finalize").Update(ctx, namespace)).To(Succeed())
+
+		reconcile()
+		Expect(workspace.Status.Stage).To(Equal(spot.WorkspaceStageDeleted))
+		Expect(workspace.Finalizers).To(ContainElement(spot.WorkspaceFinalizer))
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(workspace)})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(workspace), workspace)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
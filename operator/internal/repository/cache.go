@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Most checkouts a Cache keeps on the disk once they are not used anymore.
+const defaultCacheSize = 16
+
+// Cache keeps the checkouts of the commits of the repositories on the disk so
+// every commit is fetched once, no matter how many components or workspaces
+// are rendered from it. The least recently used checkouts are removed once
+// there are more than Size of them. The zero value is ready to use.
+type Cache struct {
+	// Most checkouts kept on the disk, the ones in use are never
+	// removed. Defaults to 16.
+	Size int
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+
+	// Fetches the checkouts, Fetch unless it's replaced by the tests.
+	fetch func(ctx context.Context, repositoryURL, branch, commit string) (*Checkout, error)
+}
+
+type cacheEntry struct {
+	// Closed once the checkout is fetched, or failed to be.
+	ready    chan struct{}
+	checkout *Checkout
+	err      error
+
+	users  int
+	usedAt time.Time
+}
+
+// Checkout returns the checkout of the commit of the repository, fetching it if
+// it's not on the disk yet. Callers asking for a commit that's being fetched wait
+// for it. The checkout needs to be closed once the content isn't needed anymore,
+// it's only removed from the disk when it's evicted from the cache.
+func (c *Cache) Checkout(ctx context.Context, repositoryURL, commit string) (*Checkout, error) {
+	if !commitPattern.MatchString(commit) {
+		return nil, fmt.Errorf("%q isn't the hash of a commit", commit)
+	}
+
+	key := Pin(repositoryURL, commit)
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry)
+	}
+
+	entry, found := c.entries[key]
+	if !found {
+		entry = &cacheEntry{ready: make(chan struct{})}
+		c.entries[key] = entry
+	}
+
+	entry.users++
+	c.mu.Unlock()
+
+	if !found {
+		fetch := c.fetch
+		if fetch == nil {
+			fetch = Fetch
+		}
+
+		entry.checkout, entry.err = fetch(ctx, repositoryURL, "", commit)
+
+		// Failures are not kept so the next caller fetches the commit again.
+		if entry.err != nil {
+			c.mu.Lock()
+			delete(c.entries, key)
+			c.mu.Unlock()
+		}
+
+		close(entry.ready)
+	}
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		c.release(entry)
+		return nil, ctx.Err()
+	}
+
+	if entry.err != nil {
+		c.release(entry)
+		return nil, entry.err
+	}
+
+	return &Checkout{Dir: entry.checkout.Dir, release: func() { c.release(entry) }}, nil
+}
+
+// release gives the checkout back to the cache and removes the checkouts
+// that don't fit in the cache anymore.
+func (c *Cache) release(entry *cacheEntry) {
+	c.mu.Lock()
+	entry.users--
+	entry.usedAt = time.Now()
+	evicted := c.evict()
+	c.mu.Unlock()
+
+	for _, checkout := range evicted {
+		checkout.Close()
+	}
+}
+
+// evict removes the least recently used checkouts from the cache until it's
+// back to its size and returns them. It needs to be called with the lock held.
+func (c *Cache) evict() []*Checkout {
+	size := c.Size
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	var evicted []*Checkout
+	for len(c.entries) > size {
+		var oldest string
+		for key, entry := range c.entries {
+			if entry.users == 0 && (len(oldest) == 0 || entry.usedAt.Before(c.entries[oldest].usedAt)) {
+				oldest = key
+			}
+		}
+
+		if len(oldest) == 0 {
+			break
+		}
+
+		evicted = append(evicted, c.entries[oldest].checkout)
+		delete(c.entries, oldest)
+	}
+
+	return evicted
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFetch records the commits it fetches and checks them out in
+// temporary directories. The commits in failing can't be fetched.
+type fakeFetch struct {
+	mu      sync.Mutex
+	fetched []string
+	failing map[string]bool
+}
+
+func (f *fakeFetch) fetch(t *testing.T) func(ctx context.Context, repositoryURL, branch, commit string) (*Checkout, error) {
+	return func(ctx context.Context, repositoryURL, branch, commit string) (*Checkout, error) {
+		f.mu.Lock()
+		f.fetched = append(f.fetched, commit)
+		f.mu.Unlock()
+
+		if f.failing[commit] {
+			return nil, errors.New("couldn't fetch")
+		}
+
+		return &Checkout{Dir: t.TempDir()}, nil
+	}
+}
+
+func commit(c byte) string {
+	return strings.Repeat(string(c), 40)
+}
+
+func TestCacheCheckout(t *testing.T) {
+	fetch := &fakeFetch{}
+	cache := &Cache{Size: 2, fetch: fetch.fetch(t)}
+	ctx := context.Background()
+
+	first, err := cache.Checkout(ctx, "github.com/my-org/my-repo", commit('a'))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second, err := cache.Checkout(ctx, "github.com/my-org/my-repo", commit('a'))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.Dir != second.Dir || len(fetch.fetched) != 1 {
+		t.Fatalf("fetched %v for the same commit", fetch.fetched)
+	}
+
+	first.Close()
+	first.Close()
+	second.Close()
+
+	if _, err := os.Stat(first.Dir); err != nil {
+		t.Fatalf("the checkout was removed once closed: %v", err)
+	}
+
+	for _, c := range []byte{'b', 'c'} {
+		checkout, err := cache.Checkout(ctx, "github.com/my-org/my-repo", commit(c))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		checkout.Close()
+	}
+
+	if _, err := os.Stat(first.Dir); !os.IsNotExist(err) {
+		t.Errorf("the least recently used checkout wasn't evicted: %v", err)
+	}
+
+	if len(cache.entries) != 2 {
+		t.Errorf("got %d checkouts in the cache, want 2", len(cache.entries))
+	}
+}
+
+func TestCacheKeepsCheckoutsInUse(t *testing.T) {
+	fetch := &fakeFetch{}
+	cache := &Cache{Size: 1, fetch: fetch.fetch(t)}
+	ctx := context.Background()
+
+	used, err := cache.Checkout(ctx, "github.com/my-org/my-repo", commit('a'))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	other, err := cache.Checkout(ctx, "github.com/my-org/my-repo", commit('b'))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	other.Close()
+
+	if _, err := os.Stat(used.Dir); err != nil {
+		t.Fatalf("a checkout in use was removed: %v", err)
+	}
+
+	if _, err := os.Stat(other.Dir); !os.IsNotExist(err) {
+		t.Errorf("the unused checkout wasn't evicted: %v", err)
+	}
+
+	used.Close()
+}
+
+func TestCacheFailures(t *testing.T) {
+	fetch := &fakeFetch{failing: map[string]bool{commit('a'): true}}
+	cache := &Cache{fetch: fetch.fetch(t)}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Checkout(ctx, "github.com/my-org/my-repo", commit('a')); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+
+	if len(fetch.fetched) != 2 {
+		t.Errorf("fetched %v, the failure shouldn't be cached", fetch.fetched)
+	}
+
+	if _, err := cache.Checkout(ctx, "github.com/my-org/my-repo", "main"); err == nil {
+		t.Error("expected an error for a branch")
+	}
+}
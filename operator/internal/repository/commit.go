@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Resolve returns the commit the branch of the repository points to. Like Fetch, a
+// `#ref` fragment on the URL wins over the branch and the default branch is used when
+// there's neither. The refs are listed with git's HTTP protocol so any host serving
+// repositories over HTTPS works, only public repositories are supported for now.
+func Resolve(ctx context.Context, repositoryURL, branch string) (string, error) {
+	ref := branchRef(repositoryURL, branch)
+	if commitPattern.MatchString(ref) {
+		return ref, nil
+	}
+
+	u, err := parse(repositoryURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git") + ".git/info/refs"
+	u.RawQuery = "service=git-upload-pack"
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't list the refs of %s: %s", repositoryURL, response.Status)
+	}
+
+	refs, err := readRefs(&limitedReader{r: response.Body, remaining: maxArchiveSize})
+	if err != nil {
+		return "", fmt.Errorf("couldn't list the refs of %s: %w", repositoryURL, err)
+	}
+
+	// Annotated tags point to the tag object, the commit is the peeled ref.
+	for _, candidate := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref + "^{}", "refs/tags/" + ref} {
+		if commit, ok := refs[candidate]; ok {
+			return commit, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s doesn't have a ref named %s", repositoryURL, ref)
+}
+
+// readRefs parses the refs advertised by the server, they are sent as pkt-lines
+// made of the commit and the name of the ref. The first ref also carries the
+// capabilities of the server after a NUL byte.
+func readRefs(r io.Reader) (map[string]string, error) {
+	refs := make(map[string]string)
+	reader := bufio.NewReader(r)
+
+	for {
+		prefix := make([]byte, 4)
+		if _, err := io.ReadFull(reader, prefix); err != nil {
+			if err == io.EOF {
+				return refs, nil
+			}
+
+			return nil, err
+		}
+
+		length, err := strconv.ParseUint(string(prefix), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pkt-line length %q", prefix)
+		}
+
+		// Flush packets separate the sections.
+		if length < 4 {
+			continue
+		}
+
+		line := make([]byte, length-4)
+		if _, err := io.ReadFull(reader, line); err != nil {
+			return nil, err
+		}
+
+		content, _, _ := strings.Cut(strings.TrimSuffix(string(line), "\n"), "\x00")
+		if strings.HasPrefix(content, "#") {
+			continue
+		}
+
+		commit, name, found := strings.Cut(content, " ")
+		if found && commitPattern.MatchString(commit) {
+			refs[name] = commit
+		}
+	}
+}
+
+// Pin returns the URL of the repository pinned to the commit with a `#commit`
+// fragment, like the contexts buildkit accepts. The URL is returned as is
+// when there's no commit.
+func Pin(repositoryURL, commit string) string {
+	if len(commit) == 0 {
+		return repositoryURL
+	}
+
+	base, _, _ := strings.Cut(repositoryURL, "#")
+	return base + "#" + commit
+}
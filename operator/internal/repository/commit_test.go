@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	mainCommit    = "1111111111111111111111111111111111111111"
+	featureCommit = "2222222222222222222222222222222222222222"
+	tagObject     = "3333333333333333333333333333333333333333"
+	taggedCommit  = "4444444444444444444444444444444444444444"
+)
+
+// pktLine encodes a line like git's smart HTTP protocol does.
+func pktLine(line string) string {
+	return fmt.Sprintf("%04x%s", len(line)+4, line)
+}
+
+func advertisement() string {
+	return strings.Join([]string{
+		pktLine("# service=git-upload-pack\n"),
+		"0000",
+		pktLine(mainCommit + " HEAD\x00multi_ack symref=HEAD:refs/heads/main\n"),
+		pktLine(mainCommit + " refs/heads/main\n"),
+		pktLine(featureCommit + " refs/heads/feature\n"),
+		pktLine(tagObject + " refs/tags/v1.0.0\n"),
+		pktLine(taggedCommit + " refs/tags/v1.0.0^{}\n"),
+		"0000",
+	}, "")
+}
+
+func TestReadRefs(t *testing.T) {
+	refs, err := readRefs(strings.NewReader(advertisement()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"HEAD":                mainCommit,
+		"refs/heads/main":     mainCommit,
+		"refs/heads/feature":  featureCommit,
+		"refs/tags/v1.0.0":    tagObject,
+		"refs/tags/v1.0.0^{}": taggedCommit,
+	}
+
+	for name, commit := range want {
+		if refs[name] != commit {
+			t.Errorf("%s: got %q, want %q", name, refs[name], commit)
+		}
+	}
+
+	if len(refs) != len(want) {
+		t.Errorf("got %d refs, want %d", len(refs), len(want))
+	}
+}
+
+func TestReadRefsInvalid(t *testing.T) {
+	if _, err := readRefs(strings.NewReader("zzzz")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/my-org/my-repo.git/info/refs" || r.URL.Query().Get("service") != "git-upload-pack" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, advertisement())
+	}))
+
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		branch string
+		want   string
+		err    bool
+	}{
+		{name: "branch", url: server.URL + "/my-org/my-repo", branch: "feature", want: featureCommit},
+		{name: "default branch", url: server.URL + "/my-org/my-repo.git", want: mainCommit},
+		{name: "annotated tag", url: server.URL + "/my-org/my-repo#v1.0.0", want: taggedCommit},
+		{name: "fragment naming a branch", url: server.URL + "/my-org/my-repo#feature", branch: "main", want: featureCommit},
+		{name: "commit", url: server.URL + "/my-org/other#" + featureCommit, want: featureCommit},
+		{name: "unknown branch", url: server.URL + "/my-org/my-repo", branch: "missing", err: true},
+		{name: "unknown repository", url: server.URL + "/my-org/other", branch: "main", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(context.Background(), tt.url, tt.branch)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPin(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		commit string
+		want   string
+	}{
+		{name: "without a commit", url: "github.com/my-org/my-repo", want: "github.com/my-org/my-repo"},
+		{name: "commit", url: "github.com/my-org/my-repo", commit: mainCommit, want: "github.com/my-org/my-repo#" + mainCommit},
+		{name: "replaces the ref", url: "github.com/my-org/my-repo#main", commit: mainCommit, want: "github.com/my-org/my-repo#" + mainCommit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Pin(tt.url, tt.commit); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Allow makes sure the repository is served over https by one of the hosts so
+// the workspaces can't have the operator send requests to the services of the
+// cluster or to the metadata endpoint of its nodes.
+func Allow(repositoryURL string, hosts []string) error {
+	u, err := parse(repositoryURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Errorf("repositories can only be fetched over https, got %q", repositoryURL)
+	}
+
+	if !MatchHost(u.Hostname(), hosts) {
+		return fmt.Errorf("repositories can't be fetched from %s, it's not one of the repository hosts of the operator", u.Host)
+	}
+
+	return nil
+}
+
+// MatchHost returns true when the host is one of the allowed hosts. An allowed
+// host starting with "*." matches any of its subdomains, but not the domain itself.
+func MatchHost(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if host == pattern {
+			return true
+		}
+
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
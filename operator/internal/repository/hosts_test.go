@@ -0,0 +1,42 @@
+package repository
+
+import "testing"
+
+func TestAllow(t *testing.T) {
+	hosts := []string{"github.com", "*.example.com"}
+
+	tests := []struct {
+		url string
+		err bool
+	}{
+		{url: "github.com/my-org/my-repo"},
+		{url: "https://github.com/my-org/my-repo.git#main"},
+		{url: "https://GitHub.com/my-org/my-repo"},
+		{url: "https://git.example.com/my-org/my-repo"},
+		{url: "https://example.com/my-org/my-repo", err: true},
+		{url: "http://github.com/my-org/my-repo", err: true},
+		{url: "https://gitlab.com/my-org/my-repo", err: true},
+		{url: "https://github.com.evil.com/my-org/my-repo", err: true},
+		{url: "https://169.254.169.254/latest/meta-data", err: true},
+		{url: "https://kubernetes.default.svc/api", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := Allow(tt.url, hosts)
+			if tt.err && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAllowWithoutHosts(t *testing.T) {
+	if err := Allow("https://github.com/my-org/my-repo", nil); err == nil {
+		t.Fatal("expected an error without any host")
+	}
+}
@@ -0,0 +1,239 @@
+// Package repository fetches the content of a workspace's repository so the
+// components deployed from manifests, a chart or a kustomization in the
+// repository can be rendered by the operator.
+package repository
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupported = errors.New("only GitHub repositories are supported")
+	ErrTooLarge    = errors.New("the repository is too large")
+)
+
+const (
+	// How long fetching the repository can take, the archive's download
+	// and its extraction included.
+	fetchTimeout = 5 * time.Minute
+
+	// Most the archive of the repository can weigh, compressed and extracted.
+	maxArchiveSize   = 256 << 20
+	maxExtractedSize = 1 << 30
+)
+
+var httpClient = &http.Client{Timeout: fetchTimeout}
+
+// Checkout is a copy of the repository at a branch on the local disk. It
+// needs to be closed once the content isn't needed anymore.
+type Checkout struct {
+	Dir string
+
+	// Gives the checkout back to the Cache it was borrowed from.
+	release func()
+}
+
+// Path returns the location of the path of the repository on the disk.
+// The path can't point outside of the repository.
+func (c *Checkout) Path(p string) string {
+	return filepath.Join(c.Dir, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// Close removes the copy of the repository. The checkouts borrowed
+// from a Cache are given back to it instead.
+func (c *Checkout) Close() error {
+	if c.release != nil {
+		c.release()
+		// Closing it again must neither release it twice nor remove it.
+		c.release = func() {}
+		return nil
+	}
+
+	return os.RemoveAll(c.Dir)
+}
+
+// Fetch downloads the commit of the repository as an archive and extracts it to
+// a temporary directory. The URL is the one of the workspace's branch, ie.
+// "github.com/my-org/my-repo", and the commit is the one the branch was
+// resolved to. The branch is fetched as is when there's no commit. Symbolic
+// links are not extracted so nothing can point outside of the checkout.
+//
+// TODO: Private repositories need the credentials of the repository.
+func Fetch(ctx context.Context, repositoryURL, branch, commit string) (*Checkout, error) {
+	ref := commit
+	if len(ref) == 0 {
+		ref = branchRef(repositoryURL, branch)
+	}
+
+	archiveURL, err := archive(repositoryURL, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't download %s at %s: %s", repositoryURL, branch, response.Status)
+	}
+
+	dir, err := os.MkdirTemp("", "spot-repository-*")
+	if err != nil {
+		return nil, err
+	}
+
+	checkout := &Checkout{Dir: dir}
+	if err := extract(&limitedReader{r: response.Body, remaining: maxArchiveSize}, dir); err != nil {
+		checkout.Close()
+		return nil, fmt.Errorf("couldn't extract %s at %s: %w", repositoryURL, branch, err)
+	}
+
+	return checkout, nil
+}
+
+// archive returns the URL of the tarball of the ref. The URL of the
+// repository can have a scheme and a `.git` suffix.
+func archive(repositoryURL, ref string) (string, error) {
+	u, err := parse(repositoryURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Host != "github.com" {
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, repositoryURL)
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/"), "/")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("%s isn't the URL of a GitHub repository", repositoryURL)
+	}
+
+	return fmt.Sprintf("https://codeload.github.com/%s/%s/tar.gz/%s", parts[0], parts[1], ref), nil
+}
+
+// branchRef returns the ref of the branch. A `#ref` fragment on the URL of the
+// repository, like the contexts buildkit accepts, wins over the branch and
+// the default branch is used when there's neither.
+func branchRef(repositoryURL, branch string) string {
+	if u, err := parse(repositoryURL); err == nil && len(u.Fragment) != 0 {
+		return u.Fragment
+	}
+
+	if len(branch) != 0 {
+		return "refs/heads/" + branch
+	}
+
+	return "HEAD"
+}
+
+func parse(repositoryURL string) (*url.URL, error) {
+	if !strings.Contains(repositoryURL, "://") {
+		repositoryURL = "https://" + repositoryURL
+	}
+
+	return url.Parse(repositoryURL)
+}
+
+// extract writes the files of the archive to dir. GitHub puts every
+// file under a top level directory which is stripped.
+func extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	defer gz.Close()
+
+	extracted := &limitedReader{r: gz, remaining: maxExtractedSize}
+	archive := tar.NewReader(extracted)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, name, found := strings.Cut(header.Name, "/")
+		if !found || len(name) == 0 {
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name)))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+
+			if _, err := io.Copy(file, archive); err != nil {
+				file.Close()
+				return err
+			}
+
+			if err := file.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// limitedReader fails with ErrTooLarge once more than the remaining
+// bytes are read, unlike io.LimitReader which ends the stream early.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// The stream might end right at the limit.
+		if n, err := l.r.Read(make([]byte, 1)); n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+
+		return 0, ErrTooLarge
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	return n, err
+}
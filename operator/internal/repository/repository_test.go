@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type entry struct {
+	name     string
+	content  string
+	typeflag byte
+	linkname string
+}
+
+func tarball(t *testing.T, entries []entry) *bytes.Buffer {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0o644, Size: int64(len(e.content))}
+		if e.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Size != 0 {
+			if _, err := io.WriteString(archive, e.content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &buffer
+}
+
+// files returns the content of every regular file under dir, keyed by their path.
+func files(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	found := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			found[filepath.ToSlash(relative)] = "<not a regular file>"
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		found[filepath.ToSlash(relative)] = string(content)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return found
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		want    map[string]string
+	}{
+		{
+			name: "strips the top level directory",
+			entries: []entry{
+				{name: "repo-abc/", typeflag: tar.TypeDir},
+				{name: "repo-abc/README.md", content: "hello", typeflag: tar.TypeReg},
+				{name: "repo-abc/deploy/", typeflag: tar.TypeDir},
+				{name: "repo-abc/deploy/web.yaml", content: "kind: Service", typeflag: tar.TypeReg},
+			},
+			want: map[string]string{"README.md": "hello", "deploy/web.yaml": "kind: Service"},
+		},
+		{
+			name: "creates the missing directories",
+			entries: []entry{
+				{name: "repo-abc/chart/templates/service.yaml", content: "kind: Service", typeflag: tar.TypeReg},
+			},
+			want: map[string]string{"chart/templates/service.yaml": "kind: Service"},
+		},
+		{
+			name: "skips the links",
+			entries: []entry{
+				{name: "repo-abc/passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+				{name: "repo-abc/hosts", typeflag: tar.TypeLink, linkname: "/etc/hosts"},
+				{name: "repo-abc/README.md", content: "hello", typeflag: tar.TypeReg},
+			},
+			want: map[string]string{"README.md": "hello"},
+		},
+		{
+			name: "keeps the files inside the checkout",
+			entries: []entry{
+				{name: "repo-abc/../../escape", content: "outside", typeflag: tar.TypeReg},
+			},
+			want: map[string]string{"escape": "outside"},
+		},
+		{
+			name: "ignores files outside of the top level directory",
+			entries: []entry{
+				{name: "pax_global_header", content: "", typeflag: tar.TypeReg},
+			},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "checkout")
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := extract(tarball(t, tt.entries), dir); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := files(t, root); !reflect.DeepEqual(got, prefixed("checkout/", tt.want)) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func prefixed(prefix string, files map[string]string) map[string]string {
+	result := make(map[string]string)
+	for name, content := range files {
+		result[prefix+name] = content
+	}
+
+	return result
+}
+
+func TestExtractInvalidArchive(t *testing.T) {
+	if err := extract(strings.NewReader("not a tarball"), t.TempDir()); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		remaining int64
+		err       error
+	}{
+		{name: "below the limit", content: "hello", remaining: 10},
+		{name: "at the limit", content: "hello", remaining: 5},
+		{name: "above the limit", content: "hello world", remaining: 5, err: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := io.ReadAll(&limitedReader{r: strings.NewReader(tt.content), remaining: tt.remaining})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if tt.err == nil && string(content) != tt.content {
+				t.Errorf("got %q, want %q", content, tt.content)
+			}
+		})
+	}
+}
+
+func TestArchive(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		ref  string
+		want string
+		err  bool
+	}{
+		{
+			name: "without a scheme",
+			url:  "github.com/my-org/my-repo",
+			ref:  "refs/heads/main",
+			want: "https://codeload.github.com/my-org/my-repo/tar.gz/refs/heads/main",
+		},
+		{
+			name: "with a scheme and a suffix",
+			url:  "https://github.com/my-org/my-repo.git",
+			ref:  "0123456789abcdef0123456789abcdef01234567",
+			want: "https://codeload.github.com/my-org/my-repo/tar.gz/0123456789abcdef0123456789abcdef01234567",
+		},
+		{
+			name: "not on GitHub",
+			url:  "gitlab.com/my-org/my-repo",
+			ref:  "HEAD",
+			err:  true,
+		},
+		{
+			name: "not a repository",
+			url:  "github.com/my-org",
+			ref:  "HEAD",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := archive(tt.url, tt.ref)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchRef(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		branch string
+		want   string
+	}{
+		{name: "branch", url: "github.com/my-org/my-repo", branch: "main", want: "refs/heads/main"},
+		{name: "fragment wins", url: "github.com/my-org/my-repo#v1.0.0", branch: "main", want: "v1.0.0"},
+		{name: "default branch", url: "github.com/my-org/my-repo", want: "HEAD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := branchRef(tt.url, tt.branch); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package routing
+
+import (
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gateway "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// HTTPRoute routes the traffic with HTTPRoutes attached to the configured Gateway.
+type HTTPRoute struct {
+	Spec spot.IngressSpec
+}
+
+func (h *HTTPRoute) Kind() string {
+	return "HTTPRoute"
+}
+
+func (h *HTTPRoute) List() client.ObjectList {
+	return &gateway.HTTPRouteList{}
+}
+
+func (h *HTTPRoute) Object(route Route) client.Object {
+	pathType := gateway.PathMatchPathPrefix
+	path := route.Path
+
+	httpRoute := &gateway.HTTPRoute{
+		TypeMeta: meta.TypeMeta{APIVersion: gateway.GroupVersion.String(), Kind: "HTTPRoute"},
+		ObjectMeta: meta.ObjectMeta{
+			Name:      route.Name,
+			Namespace: route.Namespace,
+			Labels:    route.Labels,
+		},
+		Spec: gateway.HTTPRouteSpec{
+			Rules: []gateway.HTTPRouteRule{{
+				Matches: []gateway.HTTPRouteMatch{{
+					Path: &gateway.HTTPPathMatch{Type: &pathType, Value: &path},
+				}},
+				BackendRefs: backendRefs(route.Target),
+			}},
+		},
+	}
+
+	if parent := h.Spec.Gateway; parent != nil {
+		reference := gateway.ParentReference{Name: gateway.ObjectName(parent.Name)}
+
+		if len(parent.Namespace) != 0 {
+			namespace := gateway.Namespace(parent.Namespace)
+			reference.Namespace = &namespace
+		}
+
+		if len(parent.SectionName) != 0 {
+			sectionName := gateway.SectionName(parent.SectionName)
+			reference.SectionName = &sectionName
+		}
+
+		httpRoute.Spec.ParentRefs = []gateway.ParentReference{reference}
+	}
+
+	if len(route.Host) != 0 {
+		httpRoute.Spec.Hostnames = []gateway.Hostname{gateway.Hostname(route.Host)}
+	}
+
+	return httpRoute
+}
+
+func (h *HTTPRoute) Retarget(object client.Object, target func(host, path string) *Target) bool {
+	httpRoute, ok := object.(*gateway.HTTPRoute)
+	if !ok {
+		return false
+	}
+
+	hosts := []string{""}
+	if len(httpRoute.Spec.Hostnames) != 0 {
+		hosts = nil
+		for _, hostname := range httpRoute.Spec.Hostnames {
+			hosts = append(hosts, string(hostname))
+		}
+	}
+
+	for i, rule := range httpRoute.Spec.Rules {
+		for _, match := range rule.Matches {
+			if match.Path == nil || match.Path.Value == nil {
+				continue
+			}
+
+			for _, host := range hosts {
+				t := target(host, *match.Path.Value)
+				if t == nil {
+					continue
+				}
+
+				httpRoute.Spec.Rules[i].BackendRefs = backendRefs(*t)
+			}
+		}
+	}
+
+	return true
+}
+
+// backendRefs sends the traffic of a rule to the target.
+func backendRefs(target Target) []gateway.HTTPBackendRef {
+	port := gateway.PortNumber(target.Port)
+	reference := gateway.BackendObjectReference{
+		Name: gateway.ObjectName(target.Service),
+		Port: &port,
+	}
+
+	if len(target.Namespace) != 0 {
+		namespace := gateway.Namespace(target.Namespace)
+		reference.Namespace = &namespace
+	}
+
+	return []gateway.HTTPBackendRef{{BackendRef: gateway.BackendRef{BackendObjectReference: reference}}}
+}
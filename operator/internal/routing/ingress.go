@@ -0,0 +1,105 @@
+package routing
+
+import (
+	"fmt"
+
+	networking "k8s.io/api/networking/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// Ingress routes the traffic with networking.k8s.io/v1 Ingresses.
+type Ingress struct {
+	Spec spot.IngressSpec
+}
+
+func (i *Ingress) Kind() string {
+	return "Ingress"
+}
+
+func (i *Ingress) List() client.ObjectList {
+	return &networking.IngressList{}
+}
+
+// Object returns the ingress for the route. TLS is only enabled for
+// the routes with a host as the certificate is issued for it.
+func (i *Ingress) Object(route Route) client.Object {
+	pathType := networking.PathTypePrefix
+
+	ingress := &networking.Ingress{
+		TypeMeta: meta.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+		ObjectMeta: meta.ObjectMeta{
+			Name:      route.Name,
+			Namespace: route.Namespace,
+			Labels:    route.Labels,
+		},
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{{
+				Host: route.Host,
+				IngressRuleValue: networking.IngressRuleValue{
+					HTTP: &networking.HTTPIngressRuleValue{
+						Paths: []networking.HTTPIngressPath{{
+							Path:     route.Path,
+							PathType: &pathType,
+							Backend: networking.IngressBackend{
+								Service: &networking.IngressServiceBackend{
+									Name: route.Target.Service,
+									Port: networking.ServiceBackendPort{Number: route.Target.Port},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+
+	if len(i.Spec.ClassName) != 0 {
+		className := i.Spec.ClassName
+		ingress.Spec.IngressClassName = &className
+	}
+
+	if tls := i.Spec.TLS; tls != nil && len(route.Host) != 0 {
+		secretName := tls.SecretName
+		if len(secretName) == 0 {
+			secretName = fmt.Sprintf("%s-tls", route.Name)
+		}
+
+		ingress.Spec.TLS = []networking.IngressTLS{{Hosts: []string{route.Host}, SecretName: secretName}}
+
+		if len(tls.Annotations) != 0 {
+			ingress.Annotations = make(map[string]string)
+			for key, value := range tls.Annotations {
+				ingress.Annotations[key] = value
+			}
+		}
+	}
+
+	return ingress
+}
+
+func (i *Ingress) Retarget(object client.Object, target func(host, path string) *Target) bool {
+	ingress, ok := object.(*networking.Ingress)
+	if !ok {
+		return false
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		for j := range rule.HTTP.Paths {
+			if t := target(rule.Host, rule.HTTP.Paths[j].Path); t != nil {
+				rule.HTTP.Paths[j].Backend.Service = &networking.IngressServiceBackend{
+					Name: t.Service,
+					Port: networking.ServiceBackendPort{Number: t.Port},
+				}
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+// Package routing emits the objects sending the traffic from outside of the
+// cluster to a service. The backend is picked from the IngressSpec: either
+// networking.k8s.io/v1 Ingresses or HTTPRoutes from the Gateway API.
+package routing
+
+import (
+	"errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var ErrGatewayMissing = errors.New("the HTTPRoute backend needs a gateway")
+
+// Route sends the traffic for a host and a path prefix to the port of a service.
+type Route struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+
+	// Host the route answers to. A route without
+	// a host answers to every host.
+	Host string
+	Path string
+
+	Target Target
+}
+
+// Target is the port of the service receiving the traffic.
+type Target struct {
+	Service string
+	Port    int32
+
+	// Namespace of the service when it's not the one of the route. Only
+	// the HTTPRoutes can send the traffic to another namespace and the
+	// service needs to be granted to them with a ReferenceGrant.
+	Namespace string
+}
+
+// Backend creates the objects for the routes.
+type Backend interface {
+	// Kind of the objects created by the backend.
+	Kind() string
+
+	// Object returns the object for the route, ready to be applied.
+	Object(route Route) client.Object
+
+	// List returns an empty list for the objects created by the backend.
+	List() client.ObjectList
+
+	// Retarget replaces the target of each host and path of the object with the one
+	// returned by target. Paths without a target are left untouched. It returns
+	// false when the object isn't one of the backend's objects.
+	Retarget(object client.Object, target func(host, path string) *Target) bool
+}
+
+// New returns the backend configured in the spec.
+func New(spec spot.IngressSpec) (Backend, error) {
+	switch spec.Backend {
+	case spot.RoutingBackendHTTPRoute:
+		if spec.Gateway == nil || len(spec.Gateway.Name) == 0 {
+			return nil, ErrGatewayMissing
+		}
+
+		return &HTTPRoute{Spec: spec}, nil
+	default:
+		return &Ingress{Spec: spec}, nil
+	}
+}
+
+// All returns every backend so the objects of a backend that's not
+// configured anymore can be found and removed.
+func All(spec spot.IngressSpec) []Backend {
+	return []Backend{&Ingress{Spec: spec}, &HTTPRoute{Spec: spec}}
+}
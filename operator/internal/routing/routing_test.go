@@ -0,0 +1,287 @@
+package routing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	gateway "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		spec spot.IngressSpec
+		kind string
+		err  error
+	}{
+		{
+			name: "defaults to ingresses",
+			kind: "Ingress",
+		},
+		{
+			name: "ingresses",
+			spec: spot.IngressSpec{Backend: spot.RoutingBackendIngress},
+			kind: "Ingress",
+		},
+		{
+			name: "http routes",
+			spec: spot.IngressSpec{Backend: spot.RoutingBackendHTTPRoute, Gateway: &spot.GatewayReference{Name: "public"}},
+			kind: "HTTPRoute",
+		},
+		{
+			name: "http routes without a gateway",
+			spec: spot.IngressSpec{Backend: spot.RoutingBackendHTTPRoute},
+			err:  ErrGatewayMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := New(tt.spec)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if backend.Kind() != tt.kind {
+				t.Errorf("got a backend for %s, want %s", backend.Kind(), tt.kind)
+			}
+		})
+	}
+}
+
+func TestIngress(t *testing.T) {
+	route := Route{
+		Name:      "web",
+		Namespace: "spot-shop-main",
+		Host:      "web.example.com",
+		Path:      "/",
+		Target:    Target{Service: "web", Port: 80},
+	}
+
+	tests := []struct {
+		name      string
+		spec      spot.IngressSpec
+		route     Route
+		className string
+		tls       []networking.IngressTLS
+	}{
+		{
+			name:  "without TLS",
+			route: route,
+		},
+		{
+			name:      "class name",
+			spec:      spot.IngressSpec{ClassName: "nginx"},
+			route:     route,
+			className: "nginx",
+		},
+		{
+			name:  "TLS with a secret per ingress",
+			spec:  spot.IngressSpec{TLS: &spot.IngressTLSSpec{}},
+			route: route,
+			tls:   []networking.IngressTLS{{Hosts: []string{"web.example.com"}, SecretName: "web-tls"}},
+		},
+		{
+			name:  "TLS with a shared secret",
+			spec:  spot.IngressSpec{TLS: &spot.IngressTLSSpec{SecretName: "wildcard"}},
+			route: route,
+			tls:   []networking.IngressTLS{{Hosts: []string{"web.example.com"}, SecretName: "wildcard"}},
+		},
+		{
+			name:  "no TLS without a host",
+			spec:  spot.IngressSpec{TLS: &spot.IngressTLSSpec{}},
+			route: Route{Name: "receiver", Path: "/", Target: Target{Service: "receiver", Port: 3333}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &Ingress{Spec: tt.spec}
+			ingress := backend.Object(tt.route).(*networking.Ingress)
+
+			if ingress.Name != tt.route.Name || ingress.Namespace != tt.route.Namespace {
+				t.Errorf("got %s/%s, want %s/%s", ingress.Namespace, ingress.Name, tt.route.Namespace, tt.route.Name)
+			}
+
+			rule := ingress.Spec.Rules[0]
+			if rule.Host != tt.route.Host {
+				t.Errorf("got host %q, want %q", rule.Host, tt.route.Host)
+			}
+
+			path := rule.HTTP.Paths[0]
+			if path.Path != tt.route.Path || path.Backend.Service.Name != tt.route.Target.Service || path.Backend.Service.Port.Number != tt.route.Target.Port {
+				t.Errorf("got %s to %s:%d", path.Path, path.Backend.Service.Name, path.Backend.Service.Port.Number)
+			}
+
+			var className string
+			if ingress.Spec.IngressClassName != nil {
+				className = *ingress.Spec.IngressClassName
+			}
+
+			if className != tt.className {
+				t.Errorf("got class %q, want %q", className, tt.className)
+			}
+
+			if len(ingress.Spec.TLS) != len(tt.tls) || (len(tt.tls) != 0 && ingress.Spec.TLS[0].SecretName != tt.tls[0].SecretName) {
+				t.Errorf("got TLS %+v, want %+v", ingress.Spec.TLS, tt.tls)
+			}
+		})
+	}
+}
+
+func TestHTTPRoute(t *testing.T) {
+	route := Route{
+		Name:      "web",
+		Namespace: "spot-shop-main",
+		Host:      "web.example.com",
+		Path:      "/api",
+		Target:    Target{Service: "web", Port: 80},
+	}
+
+	tests := []struct {
+		name      string
+		gateway   *spot.GatewayReference
+		route     Route
+		hostnames int
+		parent    gateway.ParentReference
+	}{
+		{
+			name:      "gateway in the same namespace",
+			gateway:   &spot.GatewayReference{Name: "public"},
+			route:     route,
+			hostnames: 1,
+			parent:    gateway.ParentReference{Name: "public"},
+		},
+		{
+			name:      "gateway in another namespace",
+			gateway:   &spot.GatewayReference{Name: "public", Namespace: "gateways", SectionName: "https"},
+			route:     route,
+			hostnames: 1,
+			parent: gateway.ParentReference{
+				Name:        "public",
+				Namespace:   (*gateway.Namespace)(strPtr("gateways")),
+				SectionName: (*gateway.SectionName)(strPtr("https")),
+			},
+		},
+		{
+			name:    "without a host",
+			gateway: &spot.GatewayReference{Name: "public"},
+			route:   Route{Name: "receiver", Path: "/", Target: Target{Service: "receiver", Port: 3333}},
+			parent:  gateway.ParentReference{Name: "public"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &HTTPRoute{Spec: spot.IngressSpec{Backend: spot.RoutingBackendHTTPRoute, Gateway: tt.gateway}}
+			httpRoute := backend.Object(tt.route).(*gateway.HTTPRoute)
+
+			if len(httpRoute.Spec.Hostnames) != tt.hostnames {
+				t.Errorf("got hostnames %v", httpRoute.Spec.Hostnames)
+			}
+
+			parents := httpRoute.Spec.ParentRefs
+			if len(parents) != 1 || !reflect.DeepEqual(parents[0], tt.parent) {
+				t.Errorf("got parents %+v, want %+v", parents, tt.parent)
+			}
+
+			rule := httpRoute.Spec.Rules[0]
+			if *rule.Matches[0].Path.Value != tt.route.Path {
+				t.Errorf("got path %q, want %q", *rule.Matches[0].Path.Value, tt.route.Path)
+			}
+
+			reference := rule.BackendRefs[0].BackendObjectReference
+			if string(reference.Name) != tt.route.Target.Service || int32(*reference.Port) != tt.route.Target.Port {
+				t.Errorf("got backend %s:%d", reference.Name, *reference.Port)
+			}
+		})
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	route := Route{Name: "web", Host: "web.example.com", Path: "/", Target: Target{Service: "web", Port: 80}}
+	other := Route{Name: "api", Host: "api.example.com", Path: "/", Target: Target{Service: "api", Port: 80}}
+
+	proxy := func(host, path string) *Target {
+		if host == "web.example.com" {
+			return &Target{Service: "proxy", Port: 3333}
+		}
+
+		return nil
+	}
+
+	for _, backend := range All(spot.IngressSpec{Gateway: &spot.GatewayReference{Name: "public"}}) {
+		t.Run(backend.Kind(), func(t *testing.T) {
+			for _, tt := range []struct {
+				route Route
+				want  Target
+			}{{route, Target{Service: "proxy", Port: 3333}}, {other, other.Target}} {
+				object := backend.Object(tt.route)
+				if !backend.Retarget(object, proxy) {
+					t.Fatal("the backend didn't recognize its own object")
+				}
+
+				if got := targetOf(object); got != tt.want {
+					t.Errorf("%s: got %+v, want %+v", tt.route.Host, got, tt.want)
+				}
+			}
+
+			for _, otherBackend := range All(spot.IngressSpec{}) {
+				if otherBackend.Kind() != backend.Kind() && backend.Retarget(otherBackend.Object(route), proxy) {
+					t.Errorf("retargeted a %s", otherBackend.Kind())
+				}
+			}
+		})
+	}
+}
+
+func TestRetargetNamespace(t *testing.T) {
+	backend := &HTTPRoute{Spec: spot.IngressSpec{Gateway: &spot.GatewayReference{Name: "public"}}}
+	route := Route{Name: "web", Host: "web.example.com", Path: "/", Target: Target{Service: "web", Port: 80}}
+	proxy := Target{Service: "receiver", Namespace: "spot-system", Port: 3334}
+
+	object := backend.Object(route)
+	backend.Retarget(object, func(host, path string) *Target { return &proxy })
+	if got := targetOf(object); got != proxy {
+		t.Errorf("got %+v, want %+v", got, proxy)
+	}
+
+	backend.Retarget(object, func(host, path string) *Target { return &route.Target })
+	if got := targetOf(object); got != route.Target {
+		t.Errorf("got %+v once restored, want %+v", got, route.Target)
+	}
+}
+
+func targetOf(object interface{}) Target {
+	switch o := object.(type) {
+	case *networking.Ingress:
+		service := o.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+		return Target{Service: service.Name, Port: service.Port.Number}
+	case *gateway.HTTPRoute:
+		reference := o.Spec.Rules[0].BackendRefs[0].BackendObjectReference
+		target := Target{Service: string(reference.Name), Port: int32(*reference.Port)}
+		if reference.Namespace != nil {
+			target.Namespace = string(*reference.Namespace)
+		}
+
+		return target
+	default:
+		return Target{}
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
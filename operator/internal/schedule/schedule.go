@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	// The time zones are embedded as the operator image doesn't
+	// necessarily ship with them.
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// Default for how long a workspace woken up by a request stays up without traffic.
+const defaultIdleTimeout = 30 * time.Minute
+
+// Window is a parsed SleepSchedule.
+type Window struct {
+	sleep cron.Schedule
+	wake  cron.Schedule
+
+	// IdleTimeout is how long a workspace woken up by
+	// a request stays up without any traffic.
+	IdleTimeout time.Duration
+}
+
+// Parse validates the cron expressions and the time zone of the schedule.
+func Parse(spec *spot.SleepSchedule) (*Window, error) {
+	timeZone := spec.TimeZone
+	if len(timeZone) == 0 {
+		timeZone = "UTC"
+	}
+
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", spec.TimeZone, err)
+	}
+
+	sleep, err := cron.ParseStandard(fmt.Sprintf("CRON_TZ=%s %s", timeZone, spec.Sleep))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sleep schedule %q: %w", spec.Sleep, err)
+	}
+
+	wake, err := cron.ParseStandard(fmt.Sprintf("CRON_TZ=%s %s", timeZone, spec.Wake))
+	if err != nil {
+		return nil, fmt.Errorf("invalid wake schedule %q: %w", spec.Wake, err)
+	}
+
+	window := &Window{sleep: sleep, wake: wake, IdleTimeout: defaultIdleTimeout}
+	if spec.IdleTimeout != nil {
+		window.IdleTimeout = spec.IdleTimeout.Duration
+	}
+
+	return window, nil
+}
+
+// Asleep returns true when now is between a sleep and the following wake. That's
+// the case when the next wake comes before the next sleep.
+func (w *Window) Asleep(now time.Time) bool {
+	return w.wake.Next(now).Before(w.sleep.Next(now))
+}
+
+// Until returns how long until the next sleep or wake, whichever comes
+// first. A nil window never transitions and returns 0.
+func (w *Window) Until(now time.Time) time.Duration {
+	if w == nil {
+		return 0
+	}
+
+	next := w.sleep.Next(now)
+	if wake := w.wake.Next(now); wake.Before(next) {
+		next = wake
+	}
+
+	return next.Sub(now)
+}
@@ -0,0 +1,151 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        spot.SleepSchedule
+		idleTimeout time.Duration
+		err         bool
+	}{
+		{
+			name:        "defaults",
+			spec:        spot.SleepSchedule{Sleep: "0 20 * * 1-5", Wake: "0 7 * * 1-5"},
+			idleTimeout: defaultIdleTimeout,
+		},
+		{
+			name:        "time zone and idle timeout",
+			spec:        spot.SleepSchedule{Sleep: "0 20 * * *", Wake: "0 7 * * *", TimeZone: "America/Montreal", IdleTimeout: &metav1.Duration{Duration: time.Hour}},
+			idleTimeout: time.Hour,
+		},
+		{
+			name: "invalid time zone",
+			spec: spot.SleepSchedule{Sleep: "0 20 * * *", Wake: "0 7 * * *", TimeZone: "Mars/Olympus"},
+			err:  true,
+		},
+		{
+			name: "invalid sleep",
+			spec: spot.SleepSchedule{Sleep: "every evening", Wake: "0 7 * * *"},
+			err:  true,
+		},
+		{
+			name: "invalid wake",
+			spec: spot.SleepSchedule{Sleep: "0 20 * * *", Wake: "0 25 * * *"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := Parse(&tt.spec)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if window.IdleTimeout != tt.idleTimeout {
+				t.Errorf("got an idle timeout of %s, want %s", window.IdleTimeout, tt.idleTimeout)
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	montreal, err := time.LoadLocation("America/Montreal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weekdays := spot.SleepSchedule{Sleep: "0 20 * * 1-5", Wake: "0 7 * * 1-5"}
+	overnight := spot.SleepSchedule{Sleep: "0 20 * * *", Wake: "0 7 * * *", TimeZone: "America/Montreal"}
+
+	tests := []struct {
+		name   string
+		spec   spot.SleepSchedule
+		now    time.Time
+		asleep bool
+		until  time.Duration
+	}{
+		{
+			name:   "during the day",
+			spec:   weekdays,
+			now:    time.Date(2023, time.May, 10, 12, 0, 0, 0, time.UTC),
+			asleep: false,
+			until:  8 * time.Hour,
+		},
+		{
+			name:   "during the night",
+			spec:   weekdays,
+			now:    time.Date(2023, time.May, 10, 23, 0, 0, 0, time.UTC),
+			asleep: true,
+			until:  8 * time.Hour,
+		},
+		{
+			name:   "right at the sleep",
+			spec:   weekdays,
+			now:    time.Date(2023, time.May, 10, 20, 0, 0, 0, time.UTC),
+			asleep: true,
+			until:  11 * time.Hour,
+		},
+		{
+			name:   "over the weekend",
+			spec:   weekdays,
+			now:    time.Date(2023, time.May, 13, 12, 0, 0, 0, time.UTC),
+			asleep: true,
+			until:  43 * time.Hour,
+		},
+		{
+			name:   "in the time zone of the schedule",
+			spec:   overnight,
+			now:    time.Date(2023, time.May, 10, 21, 0, 0, 0, montreal),
+			asleep: true,
+			until:  10 * time.Hour,
+		},
+		{
+			name:   "awake in the time zone of the schedule",
+			spec:   overnight,
+			now:    time.Date(2023, time.May, 10, 23, 0, 0, 0, time.UTC),
+			asleep: false,
+			until:  time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := Parse(&tt.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if asleep := window.Asleep(tt.now); asleep != tt.asleep {
+				t.Errorf("got asleep %t, want %t", asleep, tt.asleep)
+			}
+
+			if until := window.Until(tt.now); until != tt.until {
+				t.Errorf("got %s until the next transition, want %s", until, tt.until)
+			}
+		})
+	}
+}
+
+func TestNilWindow(t *testing.T) {
+	var window *Window
+	if until := window.Until(time.Now()); until != 0 {
+		t.Errorf("got %s, want 0", until)
+	}
+}
@@ -0,0 +1,104 @@
+package stages
+
+import (
+	"context"
+
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// deployAutoscaler applies the HorizontalPodAutoscaler scaling the component's
+// Deployment. It's named after the component like the Deployment.
+func (d *Deployment) deployAutoscaler(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error {
+	autoscaler := &autoscaling.HorizontalPodAutoscaler{
+		TypeMeta: meta.TypeMeta{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler"},
+		ObjectMeta: meta.ObjectMeta{
+			Name:      component.Name,
+			Namespace: namespaceFor(workspace),
+			Labels:    d.labels(workspace, component),
+		},
+		Spec: autoscaling.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscaling.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       component.Name,
+			},
+			MinReplicas: component.Autoscaling.GetMinReplicas(),
+			MaxReplicas: component.Autoscaling.MaxReplicas,
+			Metrics:     component.Autoscaling.Metrics(),
+		},
+	}
+
+	return d.apply(ctx, autoscaler)
+}
+
+// Refresh records the replicas of the components in the workspace's status while
+// it's running so the decisions of the autoscalers show up. The status is only
+// updated when the replicas changed.
+func (d *Deployment) Refresh(ctx context.Context, workspace *spot.Workspace) error {
+	changed, err := d.refreshReplicas(ctx, workspace)
+	if err != nil || !changed {
+		return err
+	}
+
+	return d.Client.SubResource("status").Update(ctx, workspace)
+}
+
+// refreshReplicas records the number of pods of every component running an image in
+// the workspace's status, along with the number it's scaled to. The autoscaler decides
+// how many pods the autoscaled components need. Components that are not deployed
+// yet, jobs and the ones rendered from manifests are left out. It returns true
+// when the replicas of a component changed.
+func (d *Deployment) refreshReplicas(ctx context.Context, workspace *spot.Workspace) (bool, error) {
+	changed := false
+	for _, component := range workspace.Spec.Components {
+		status, ok := workspace.Status.Components[component.Name]
+		if !ok || len(status.Hash) == 0 || component.IsJob() || component.Deployer() != "image" {
+			continue
+		}
+
+		var deployment apps.Deployment
+		if err := d.Client.Get(ctx, client.ObjectKey{Namespace: namespaceFor(workspace), Name: component.Name}, &deployment); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+
+			return false, err
+		}
+
+		replicas := deployment.Status.Replicas
+		desired := *component.GetReplicas()
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+
+		if component.Autoscaling != nil {
+			var autoscaler autoscaling.HorizontalPodAutoscaler
+			err := d.Client.Get(ctx, client.ObjectKey{Namespace: namespaceFor(workspace), Name: component.Name}, &autoscaler)
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return false, err
+			}
+
+			// The autoscaler doesn't have a decision until it first reads the metrics.
+			if err == nil && autoscaler.Status.DesiredReplicas != 0 {
+				desired = autoscaler.Status.DesiredReplicas
+			}
+		}
+
+		if status.Replicas == replicas && status.DesiredReplicas == desired {
+			continue
+		}
+
+		status.Replicas = replicas
+		status.DesiredReplicas = desired
+		workspace.Status.Components[component.Name] = status
+		changed = true
+	}
+
+	return changed, nil
+}
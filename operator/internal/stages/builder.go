@@ -3,16 +3,29 @@ package stages
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/releasehub-com/spot/operator/internal/repository"
 )
 
+// Annotation set on the builds to list the components
+// that are going to use the image once it's built.
+const componentsAnnotation = "spot.release.com/components"
+
 type Builder struct {
 	client.Client
+
+	// Hosts the branches of the workspaces can be resolved from. A
+	// leading "*." allows any subdomain of the host.
+	Repositories []string
 }
 
 func (b *Builder) Start(ctx context.Context, workspace *spot.Workspace) error {
@@ -26,35 +39,9 @@ func (b *Builder) Start(ctx context.Context, workspace *spot.Workspace) error {
 		return errors.New("Workspace.Spec.Tag is not set")
 	}
 
-	var builds []*spot.Build
-	for _, component := range workspace.Spec.Components {
-		if component.Image.Registry == nil {
-			// This image is not going to be built, let's exclude it from the build slice
-			continue
-		}
-
-		build := &spot.Build{
-			ObjectMeta: meta.ObjectMeta{
-				Namespace:    workspace.Namespace,
-				GenerateName: "my-build-",
-				OwnerReferences: []meta.OwnerReference{
-					{
-						Kind:       workspace.Kind,
-						Name:       workspace.Name,
-						APIVersion: workspace.APIVersion,
-						UID:        workspace.UID,
-					},
-				},
-			},
-			Spec: spot.BuildSpec{
-				Image:           component.Image,
-				DefaultImageTag: *workspace.Spec.Tag,
-				RepositoryURL:   workspace.Spec.Branch.URL,
-			},
-		}
+	b.resolveCommit(ctx, workspace)
 
-		builds = append(builds, build)
-	}
+	builds := b.desiredBuilds(workspace)
 
 	var references []spot.BuildReference
 	for _, build := range builds {
@@ -67,40 +54,327 @@ func (b *Builder) Start(ctx context.Context, workspace *spot.Workspace) error {
 	}
 
 	workspace.Status.Builds = references
-	workspace.Status.Stage = spot.WorkspaceStageBuilding
+	workspace.Status.BuildProgress = spot.BuildProgress{Pending: len(references)}
+	workspace.SetStage(spot.WorkspaceStageBuilding, "")
+	workspace.SetCondition(spot.WorkspaceConditionBuildsSucceeded, meta.ConditionUnknown, spot.ReasonBuildsPending, fmt.Sprintf("Waiting on %d builds", len(references)))
+	workspace.SetCondition(spot.WorkspaceConditionDeployed, meta.ConditionFalse, spot.ReasonDeployPending, "Waiting on the builds to complete")
+	workspace.Status.ObservedGeneration = workspace.Generation
 
 	return b.Client.Status().Update(ctx, workspace)
 }
 
-// Reconcile attempts to finish the work toward the next stage for the Workspace.
-// If it succeeds, it will return the Stage that should follow so the reconciler can act on that new information
-// It's normal that the Work function can't finish up the work in 1 go as there might be work that needs to happen
-// asynchronously.
+// Rebuild compares the builds the workspace needs for its current spec with the ones
+// it already has. Builds with the same inputs are kept, along with their images, and new builds
+// are only created for the components that changed. Builds that are not needed anymore
+// are removed. The workspace is moved to the Updating stage.
+func (b *Builder) Rebuild(ctx context.Context, workspace *spot.Workspace) error {
+	b.resolveCommit(ctx, workspace)
+
+	return b.replaceBuilds(ctx, workspace, spot.WorkspaceStageUpdating)
+}
+
+// Retry replaces the builds that errored and moves the workspace back to the stage
+// it failed in. The builds that succeeded are kept along with their images.
+func (b *Builder) Retry(ctx context.Context, workspace *spot.Workspace) error {
+	b.resolveCommit(ctx, workspace)
+
+	return b.replaceBuilds(ctx, workspace, workspace.Status.FailedStage)
+}
+
+// replaceBuilds reuses every build that didn't error and still matches the spec,
+// creates the missing ones and deletes the rest. The workspace is then moved to the stage.
+func (b *Builder) replaceBuilds(ctx context.Context, workspace *spot.Workspace, stage spot.WorkspaceStage) error {
+	logger := log.FromContext(ctx)
+
+	if workspace.Spec.Tag == nil || len(*workspace.Spec.Tag) == 0 {
+		return errors.New("Workspace.Spec.Tag is not set")
+	}
+
+	existing := make(map[spot.BuildReference]*spot.Build)
+	for _, reference := range workspace.Status.Builds {
+		var build spot.Build
+		if err := b.Client.Get(ctx, client.ObjectKey{Namespace: reference.Namespace, Name: reference.Name}, &build); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+
+		existing[reference] = &build
+	}
+
+	var references []spot.BuildReference
+	images := make(map[string]spot.BuildImage)
+
+	for _, desired := range b.desiredBuilds(workspace) {
+		var reference *spot.BuildReference
+		for ref, build := range existing {
+			if build.Status.Stage != spot.BuildStageError && buildKey(build.Spec) == buildKey(desired.Spec) {
+				reference = &ref
+				break
+			}
+		}
+
+		if reference != nil {
+			// Nothing changed for this build, the image it built (or is building)
+			// can be reused as is.
+			delete(existing, *reference)
+		} else {
+			if err := b.Client.Create(ctx, desired); err != nil {
+				logger.Error(err, "unexpected error creating a build")
+				return b.markWorkspaceHasErrored(ctx, workspace, err)
+			}
+
+			ref := desired.GetReference()
+			reference = &ref
+		}
+
+		references = append(references, *reference)
+
+		key := imageKey(desired.Spec.Image, desired.Spec.DefaultImageTag)
+		if image, ok := workspace.Status.Images[key]; ok {
+			images[key] = image
+		}
+	}
+
+	// Whatever is left is not needed by this workspace anymore
+	var obsolete []spot.ResourceReference
+	for _, build := range existing {
+		if err := b.Client.Delete(ctx, build); err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+
+		obsolete = append(obsolete, spot.ResourceReference{Kind: "Build", Namespace: build.Namespace, Name: build.Name})
+	}
+
+	teardown := Teardown{Client: b.Client}
+	if _, err := teardown.deleteBuilderPods(ctx, obsolete); err != nil {
+		return err
+	}
+
+	workspace.Status.Builds = references
+	workspace.Status.BuildProgress = spot.BuildProgress{Pending: len(references)}
+	workspace.Status.Images = images
+	workspace.SetStage(stage, "")
+	workspace.SetCondition(spot.WorkspaceConditionBuildsSucceeded, meta.ConditionUnknown, spot.ReasonBuildsPending, fmt.Sprintf("Waiting on %d builds", len(references)))
+	workspace.SetCondition(spot.WorkspaceConditionDeployed, meta.ConditionFalse, spot.ReasonDeployPending, "Waiting on the builds to complete")
+	workspace.Status.ObservedGeneration = workspace.Generation
+
+	return b.Client.Status().Update(ctx, workspace)
+}
+
+// Update tracks the progress of the builds listed in the workspace's status and seeds the
+// images of the builds that are done. It's normal that the builds can't finish up in 1 go,
+// the workspace owns its builds and is reconciled every time one of them changes.
+//
+// Once all the builds are done, a workspace in the Building stage moves to Deploying. A workspace
+// that's Updating stays in its stage and it's up to the reconciler to roll out the changes.
 func (b *Builder) Update(ctx context.Context, workspace *spot.Workspace) error {
-	// logger := log.FromContext(ctx)
-	if err := b.trackProgressAndUpdate(ctx, workspace); err != nil {
-		b.markWorkspaceHasErrored(ctx, workspace, err)
+	if err := b.trackProgress(ctx, workspace); err != nil {
+		return b.markWorkspaceHasErrored(ctx, workspace, err)
 	}
 
-	if b.completed(workspace) {
-		workspace.Status.Stage = spot.WorkspaceStageDeploying
-		return b.Client.Status().Update(ctx, workspace)
+	if b.Completed(workspace) {
+		if workspace.Status.Stage == spot.WorkspaceStageBuilding {
+			workspace.SetStage(spot.WorkspaceStageDeploying, "")
+		}
+
+		workspace.SetCondition(spot.WorkspaceConditionBuildsSucceeded, meta.ConditionTrue, spot.ReasonBuildsDone, fmt.Sprintf("%d builds done", len(workspace.Status.Builds)))
+	} else {
+		progress := workspace.Status.BuildProgress
+		workspace.SetCondition(spot.WorkspaceConditionBuildsSucceeded, meta.ConditionUnknown, spot.ReasonBuildsPending, fmt.Sprintf("%d pending, %d running, %d done", progress.Pending, progress.Running, progress.Done))
 	}
 
-	// Build stage is not completed but it's progressing, return with no error
+	// Build stage is not completed but it's progressing, persist the progress
 	// and wait for an update from one of the builds to re-evaluate.
-	return nil
+	return b.Client.Status().Update(ctx, workspace)
 }
 
-func (b *Builder) trackProgressAndUpdate(ctx context.Context, workspace *spot.Workspace) error {
+// trackProgress counts the builds in each stage and records the image of every build
+// that's done. An error is returned if any of the builds failed.
+func (b *Builder) trackProgress(ctx context.Context, workspace *spot.Workspace) error {
+	progress := spot.BuildProgress{}
+
+	if workspace.Status.Images == nil {
+		workspace.Status.Images = make(map[string]spot.BuildImage)
+	}
+
+	for _, reference := range workspace.Status.Builds {
+		var build spot.Build
+		if err := b.Client.Get(ctx, client.ObjectKey{Namespace: reference.Namespace, Name: reference.Name}, &build); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return fmt.Errorf("build %s is missing", reference.String())
+			}
+
+			return err
+		}
+
+		switch build.Status.Stage {
+		case spot.BuildStageInitialized:
+			progress.Pending++
+		case spot.BuildStageRunning:
+			progress.Running++
+		case spot.BuildStageError:
+			progress.Errored++
+		case spot.BuildStageDone:
+			if build.Status.Image == nil {
+				// The stage was updated but not the image yet,
+				// it'll be picked up on the next update.
+				progress.Running++
+				continue
+			}
+
+			progress.Done++
+			workspace.Status.Images[imageKey(build.Spec.Image, build.Spec.DefaultImageTag)] = *build.Status.Image
+		}
+	}
+
+	workspace.Status.BuildProgress = progress
+
+	if progress.Errored != 0 {
+		return fmt.Errorf("%d out of %d builds failed", progress.Errored, len(workspace.Status.Builds))
+	}
+
 	return nil
 }
 
-func (b *Builder) completed(workspace *spot.Workspace) bool {
-	return len(workspace.Status.Images) == 1
+// Completed returns true when every build listed in the workspace's status is done
+// and its image was seeded in the status.
+func (b *Builder) Completed(workspace *spot.Workspace) bool {
+	return workspace.Status.BuildProgress.Done == len(workspace.Status.Builds)
+}
+
+// desiredBuilds returns the builds needed for the workspace's current spec. None
+// of the returned builds exist yet.
+//
+// Components that share the same image are deduplicated so each unique image is built
+// only once. The image is then seeded in the workspace's status under a key every
+// component referencing it resolves to. The images of the sidecars and init containers
+// are built the same way as the component's image.
+func (b *Builder) desiredBuilds(workspace *spot.Workspace) []*spot.Build {
+	var builds []*spot.Build
+	unique := make(map[string]*spot.Build)
+
+	for _, component := range workspace.Spec.Components {
+		for _, image := range component.Images() {
+			if image.Registry == nil {
+				// This image is not going to be built, let's exclude it from the build slice
+				continue
+			}
+
+			spec := spot.BuildSpec{
+				Image:           image,
+				DefaultImageTag: *workspace.Spec.Tag,
+				RepositoryURL:   repository.Pin(workspace.Spec.Branch.URL, workspace.Status.Commit),
+			}
+
+			key := buildKey(spec)
+			if build, ok := unique[key]; ok {
+				components := strings.Split(build.Annotations[componentsAnnotation], ",")
+				if components[len(components)-1] != component.Name {
+					build.Annotations[componentsAnnotation] = strings.Join(append(components, component.Name), ",")
+				}
+
+				continue
+			}
+
+			build := &spot.Build{
+				ObjectMeta: meta.ObjectMeta{
+					Namespace:    workspace.Namespace,
+					GenerateName: "my-build-",
+					Labels: map[string]string{
+						spot.WorkspaceLabel: workspace.Name,
+					},
+					Annotations: map[string]string{
+						componentsAnnotation: component.Name,
+					},
+					OwnerReferences: []meta.OwnerReference{
+						*meta.NewControllerRef(workspace, spot.GroupVersion.WithKind("Workspace")),
+					},
+				},
+				Spec: spec,
+			}
+
+			unique[key] = build
+			builds = append(builds, build)
+		}
+	}
+
+	return builds
+}
+
+// resolveCommit records the commit the workspace's branch points to so the images and
+// the manifests of the components come from the same commit. The branch is resolved
+// once per generation of the workspace and only from the allowed Repositories.
+// Repositories that can't be resolved, like private ones, are built from the branch
+// as is and their components can't be rendered from the repository.
+func (b *Builder) resolveCommit(ctx context.Context, workspace *spot.Workspace) {
+	if workspace.Status.CommitGeneration == workspace.Generation {
+		return
+	}
+
+	workspace.Status.Commit = ""
+	workspace.Status.CommitGeneration = workspace.Generation
+	if len(workspace.Spec.Branch.URL) == 0 {
+		return
+	}
+
+	logger := log.FromContext(ctx).WithValues("url", workspace.Spec.Branch.URL, "branch", workspace.Spec.Branch.Name)
+	if err := repository.Allow(workspace.Spec.Branch.URL, b.Repositories); err != nil {
+		logger.Error(err, "couldn't resolve the commit of the branch")
+		return
+	}
+
+	commit, err := repository.Resolve(ctx, workspace.Spec.Branch.URL, workspace.Spec.Branch.Name)
+	if err != nil {
+		logger.Error(err, "couldn't resolve the commit of the branch")
+		return
+	}
+
+	workspace.Status.Commit = commit
+}
+
+// buildKey identifies the image a build produces. Two builds with the same key
+// build the exact same image and only one of them is needed.
+func buildKey(spec spot.BuildSpec) string {
+	var contextPath, dockerfile string
+	if context := spec.Image.RepositoryContext; context != nil {
+		contextPath = context.Path
+		dockerfile = context.Dockerfile
+	}
+
+	var registry string
+	if spec.Image.Registry != nil {
+		registry = spec.Image.Registry.URL
+	}
+
+	tag := spec.DefaultImageTag
+	if spec.Image.Tag != nil {
+		tag = *spec.Image.Tag
+	}
+
+	return strings.Join([]string{spec.RepositoryURL, contextPath, dockerfile, registry, tag}, "|")
+}
+
+// imageKey is the key used to store the image built for an ImageSpec
+// in the workspace's status.
+func imageKey(image spot.ImageSpec, defaultTag string) string {
+	tag := defaultTag
+	if image.Tag != nil {
+		tag = *image.Tag
+	}
+
+	url := image.Name
+	if image.Registry != nil {
+		url = image.Registry.URL
+	}
+
+	return fmt.Sprintf("%s:%s", url, tag)
 }
 
 func (b *Builder) markWorkspaceHasErrored(ctx context.Context, workspace *spot.Workspace, err error) error {
-	workspace.Status.Stage = spot.WorkspaceStageError
+	workspace.SetStage(spot.WorkspaceStageError, err.Error())
+	workspace.SetCondition(spot.WorkspaceConditionBuildsSucceeded, meta.ConditionFalse, spot.ReasonBuildFailed, err.Error())
 	return b.Client.Status().Update(ctx, workspace)
 }
@@ -0,0 +1,176 @@
+package stages
+
+import (
+	"context"
+	"testing"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+func TestBuildKey(t *testing.T) {
+	tag := func(s string) *string { return &s }
+	build := func(image spot.ImageSpec) spot.BuildSpec {
+		return spot.BuildSpec{RepositoryURL: "github.com/my-org/my-repo#abc", DefaultImageTag: "main", Image: image}
+	}
+
+	web := spot.ImageSpec{
+		Name:              "web",
+		Registry:          &spot.RegistrySpec{URL: "registry.example.com/web"},
+		RepositoryContext: &spot.RepositoryContextSpec{Dockerfile: "Dockerfile", Path: "."},
+	}
+
+	tests := []struct {
+		name string
+		a, b spot.BuildSpec
+		same bool
+	}{
+		{
+			name: "same image",
+			a:    build(web),
+			b:    build(web),
+			same: true,
+		},
+		{
+			name: "name isn't part of the image",
+			a:    build(web),
+			b:    build(spot.ImageSpec{Name: "other", Registry: web.Registry, RepositoryContext: web.RepositoryContext}),
+			same: true,
+		},
+		{
+			name: "default tag set explicitly",
+			a:    build(web),
+			b:    build(spot.ImageSpec{Name: "web", Registry: web.Registry, RepositoryContext: web.RepositoryContext, Tag: tag("main")}),
+			same: true,
+		},
+		{
+			name: "another tag",
+			a:    build(web),
+			b:    build(spot.ImageSpec{Name: "web", Registry: web.Registry, RepositoryContext: web.RepositoryContext, Tag: tag("v1")}),
+		},
+		{
+			name: "another dockerfile",
+			a:    build(web),
+			b: build(spot.ImageSpec{Name: "web", Registry: web.Registry, RepositoryContext: &spot.RepositoryContextSpec{
+				Dockerfile: "Dockerfile.worker",
+				Path:       ".",
+			}}),
+		},
+		{
+			name: "another registry",
+			a:    build(web),
+			b:    build(spot.ImageSpec{Name: "web", Registry: &spot.RegistrySpec{URL: "registry.example.com/other"}, RepositoryContext: web.RepositoryContext}),
+		},
+		{
+			name: "another commit",
+			a:    build(web),
+			b:    spot.BuildSpec{RepositoryURL: "github.com/my-org/my-repo#def", DefaultImageTag: "main", Image: web},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := buildKey(tt.a), buildKey(tt.b)
+			if tt.same && a != b {
+				t.Errorf("got distinct keys %q and %q", a, b)
+			}
+
+			if !tt.same && a == b {
+				t.Errorf("got the same key %q", a)
+			}
+		})
+	}
+}
+
+func TestImageKey(t *testing.T) {
+	tag := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		image spot.ImageSpec
+		want  string
+	}{
+		{
+			name:  "default tag",
+			image: spot.ImageSpec{Name: "redis"},
+			want:  "redis:main",
+		},
+		{
+			name:  "tag",
+			image: spot.ImageSpec{Name: "redis", Tag: tag("7")},
+			want:  "redis:7",
+		},
+		{
+			name:  "registry",
+			image: spot.ImageSpec{Name: "web", Registry: &spot.RegistrySpec{URL: "registry.example.com/web"}},
+			want:  "registry.example.com/web:main",
+		},
+		{
+			name:  "registry and tag",
+			image: spot.ImageSpec{Name: "web", Registry: &spot.RegistrySpec{URL: "registry.example.com/web"}, Tag: tag("v1")},
+			want:  "registry.example.com/web:v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imageKey(tt.image, "main"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCommit(t *testing.T) {
+	commit := "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		name       string
+		url        string
+		generation int64
+		status     spot.WorkspaceStatus
+		want       string
+		wantGen    int64
+	}{
+		{
+			name:       "resolved for the generation",
+			url:        "https://github.com/my-org/my-repo",
+			status:     spot.WorkspaceStatus{Commit: commit, CommitGeneration: 2},
+			generation: 2,
+			want:       commit,
+			wantGen:    2,
+		},
+		{
+			name:       "host that's not allowed",
+			url:        "https://169.254.169.254/my-org/my-repo#" + commit,
+			status:     spot.WorkspaceStatus{Commit: commit, CommitGeneration: 1},
+			generation: 2,
+			wantGen:    2,
+		},
+		{
+			name:       "pinned to a commit",
+			url:        "https://github.com/my-org/my-repo#" + commit,
+			generation: 1,
+			want:       commit,
+			wantGen:    1,
+		},
+		{
+			name:       "without a URL",
+			generation: 3,
+			wantGen:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := &spot.Workspace{Spec: spot.WorkspaceSpec{Branch: spot.BranchSpec{URL: tt.url, Name: "main"}}, Status: tt.status}
+			workspace.Generation = tt.generation
+
+			builder := &Builder{Repositories: []string{"github.com"}}
+			builder.resolveCommit(context.Background(), workspace)
+
+			if workspace.Status.Commit != tt.want || workspace.Status.CommitGeneration != tt.wantGen {
+				t.Errorf("got %q for generation %d, want %q for %d", workspace.Status.Commit, workspace.Status.CommitGeneration, tt.want, tt.wantGen)
+			}
+		})
+	}
+}
@@ -0,0 +1,709 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/releasehub-com/spot/operator/internal/repository"
+	"github.com/releasehub-com/spot/operator/internal/routing"
+)
+
+// deployer deploys one kind of component. The objects of the components running an
+// image are derived from their spec while the other components render theirs from
+// manifests, a Helm chart or a kustomization.
+type deployer interface {
+	// deployServices applies the objects the other components reach the component
+	// through. It's called for every component before any workload is deployed.
+	deployServices(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error
+
+	// deployWorkload applies the objects running the component. It returns the
+	// objects it applied when they can't be derived from the component's spec.
+	deployWorkload(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]spot.ResourceReference, error)
+
+	// desired returns the objects of the component that are not pruned, as `Kind/name`.
+	desired(workspace *spot.Workspace, component *spot.ComponentSpec) ([]string, error)
+
+	// started tells whether the components depending on this one can be deployed.
+	started(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (bool, error)
+
+	// notReady returns why the component isn't ready, nil when it is.
+	notReady(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (*notReadyComponent, error)
+}
+
+func (d *Deployment) deployer(component *spot.ComponentSpec) deployer {
+	switch component.Deployer() {
+	case "manifests":
+		return &renderedDeployer{Deployment: d, render: d.renderManifests}
+	case "helm":
+		return &renderedDeployer{Deployment: d, render: d.renderHelm}
+	case "kustomize":
+		return &renderedDeployer{Deployment: d, render: d.renderKustomize}
+	default:
+		return &imageDeployer{Deployment: d}
+	}
+}
+
+// imageDeployer deploys the components running an image. Every object
+// is derived from the component's spec.
+type imageDeployer struct {
+	*Deployment
+}
+
+func (i *imageDeployer) deployServices(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error {
+	if err := i.deployService(ctx, workspace, component); err != nil {
+		return err
+	}
+
+	return i.deployVolumes(ctx, workspace, component)
+}
+
+func (i *imageDeployer) deployWorkload(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]spot.ResourceReference, error) {
+	return nil, i.Deployment.deployWorkload(ctx, workspace, component)
+}
+
+func (i *imageDeployer) desired(workspace *spot.Workspace, component *spot.ComponentSpec) ([]string, error) {
+	backend, err := routing.New(i.Ingress)
+	if err != nil {
+		return nil, err
+	}
+
+	var desired []string
+	if component.IsJob() {
+		name, err := i.jobName(workspace, component)
+		if err != nil {
+			return nil, err
+		}
+
+		desired = append(desired, "Job/"+name)
+	} else {
+		desired = append(desired, "Deployment/"+component.Name)
+	}
+
+	if component.Autoscaling != nil {
+		desired = append(desired, "HorizontalPodAutoscaler/"+component.Name)
+	}
+
+	for _, volume := range component.Volumes {
+		desired = append(desired, "PersistentVolumeClaim/"+claimName(component, &volume))
+	}
+
+	if len(component.AllServices()) != 0 {
+		desired = append(desired, "Service/"+component.Name)
+	}
+
+	for _, service := range component.AllServices() {
+		if len(service.Ingress) != 0 {
+			desired = append(desired, backend.Kind()+"/"+routeName(component, &service))
+		}
+	}
+
+	return desired, nil
+}
+
+// started returns true once the component is ready. Jobs need to have succeeded.
+func (i *imageDeployer) started(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (bool, error) {
+	notReady, err := i.notReady(ctx, workspace, component)
+	return notReady == nil, err
+}
+
+// notReady reports the components whose Deployment didn't complete its rollout
+// and the jobs that didn't succeed. A job that failed won't ever be ready, nor a
+// Deployment past its progress deadline. The pods of the component that are
+// not ready tell why the rollout is held.
+func (i *imageDeployer) notReady(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (*notReadyComponent, error) {
+	if component.IsJob() {
+		succeeded, failure, err := i.jobResult(ctx, workspace, component)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(failure) != 0 {
+			return &notReadyComponent{name: component.Name, reason: failure, failed: true}, nil
+		}
+
+		if !succeeded {
+			return &notReadyComponent{name: component.Name, reason: "job didn't complete yet"}, nil
+		}
+
+		return nil, nil
+	}
+
+	var deployment apps.Deployment
+	if err := i.Client.Get(ctx, client.ObjectKey{Namespace: namespaceFor(workspace), Name: component.Name}, &deployment); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return &notReadyComponent{name: component.Name, reason: "deployment not found"}, nil
+		}
+
+		return nil, err
+	}
+
+	reason, failed := rolloutNotReady(&deployment)
+	if len(reason) == 0 {
+		return nil, nil
+	}
+
+	var pods core.PodList
+	if err := i.Client.List(ctx, &pods, client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name, spot.ComponentLabel: component.Name}); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && !podReady(&pod) {
+			reason = fmt.Sprintf("%s, %s", reason, podFailure(&pod))
+			break
+		}
+	}
+
+	return &notReadyComponent{name: component.Name, reason: reason, failed: failed, deadline: true}, nil
+}
+
+// renderedKinds are the kinds of objects the components can render. Anything else, like
+// roles or DaemonSets, fails the deployment so the workspaces can't grant themselves
+// permissions or run pods the operator doesn't put to sleep.
+var renderedKinds = map[schema.GroupKind]bool{
+	{Kind: "ConfigMap"}:                                     true,
+	{Kind: "Secret"}:                                        true,
+	{Kind: "Service"}:                                       true,
+	{Kind: "ServiceAccount"}:                                true,
+	{Kind: "PersistentVolumeClaim"}:                         true,
+	{Group: "apps", Kind: "Deployment"}:                     true,
+	{Group: "apps", Kind: "StatefulSet"}:                    true,
+	{Group: "batch", Kind: "Job"}:                           true,
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}: true,
+	{Group: "networking.k8s.io", Kind: "Ingress"}:           true,
+	{Group: "gateway.networking.k8s.io", Kind: "HTTPRoute"}: true,
+}
+
+// podTemplateFields locates the pod template of the rendered workloads.
+var podTemplateFields = map[schema.GroupKind][]string{
+	{Group: "apps", Kind: "Deployment"}:  {"spec", "template"},
+	{Group: "apps", Kind: "StatefulSet"}: {"spec", "template"},
+	{Group: "batch", Kind: "Job"}:        {"spec", "template"},
+}
+
+// renderedDeployer deploys the components whose objects are rendered from manifests.
+// Every object is moved to the workspace's namespace, labeled like the objects of the
+// other components and has the placeholders of its strings replaced before it's applied.
+// The pods of the workloads get the component's security settings and resource ceiling.
+// The objects are recorded in the component's status so the ones that are not rendered
+// anymore can be removed. Objects of a kind that's not in renderedKinds, or that already
+// exist without belonging to the component, fail the deployment.
+type renderedDeployer struct {
+	*Deployment
+
+	render func(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]*unstructured.Unstructured, error)
+}
+
+// deployServices doesn't do anything, the rendered services
+// are applied with the rest of the component's objects.
+func (r *renderedDeployer) deployServices(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error {
+	return nil
+}
+
+func (r *renderedDeployer) deployWorkload(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]spot.ResourceReference, error) {
+	objects, err := r.render(ctx, workspace, component)
+	if err != nil {
+		return nil, err
+	}
+
+	replacer, err := r.placeholders(workspace, component)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []spot.ResourceReference
+	applied := make(map[string]bool)
+
+	for _, object := range objects {
+		if err := r.prepare(workspace, component, object, replacer); err != nil {
+			return nil, err
+		}
+
+		if err := r.claim(ctx, component, object); err != nil {
+			return nil, err
+		}
+
+		if err := r.apply(ctx, object); err != nil {
+			return nil, err
+		}
+
+		reference := spot.ResourceReference{
+			APIVersion: object.GetAPIVersion(),
+			Kind:       object.GetKind(),
+			Namespace:  object.GetNamespace(),
+			Name:       object.GetName(),
+		}
+
+		references = append(references, reference)
+		applied[referenceKey(reference)] = true
+	}
+
+	var stale []spot.ResourceReference
+	for _, reference := range workspace.Status.Components[component.Name].Objects {
+		if !applied[referenceKey(reference)] {
+			stale = append(stale, reference)
+		}
+	}
+
+	if _, err := deleteObjects(ctx, r.Client, stale); err != nil {
+		return nil, err
+	}
+
+	return references, nil
+}
+
+// prepare moves the object to the workspace's namespace, labels it, replaces the
+// placeholders of its strings and secures its pods. Cluster scoped objects and objects
+// that belong to another namespace are not supported.
+func (r *renderedDeployer) prepare(workspace *spot.Workspace, component *spot.ComponentSpec, object *unstructured.Unstructured, replacer *strings.Replacer) error {
+	gvk := object.GroupVersionKind()
+	if !renderedKinds[gvk.GroupKind()] {
+		return fmt.Errorf("component %s renders %s %s, it's not one of the kinds the operator deploys", component.Name, gvk.Kind, object.GetName())
+	}
+
+	// The tokens of the service accounts are only handed out to their pods.
+	if gvk.GroupKind() == (schema.GroupKind{Kind: "Secret"}) {
+		if kind, _, _ := unstructured.NestedString(object.Object, "type"); kind == string(core.SecretTypeServiceAccountToken) {
+			return fmt.Errorf("component %s renders the service account token %s, tokens can't be rendered", component.Name, object.GetName())
+		}
+	}
+
+	mapping, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("component %s renders %s %s: %w", component.Name, gvk.Kind, object.GetName(), err)
+	}
+
+	if mapping.Scope.Name() != apimeta.RESTScopeNameNamespace {
+		return fmt.Errorf("component %s renders %s %s which is cluster scoped, only namespaced objects are supported", component.Name, gvk.Kind, object.GetName())
+	}
+
+	namespace := namespaceFor(workspace)
+	if len(object.GetNamespace()) != 0 && object.GetNamespace() != namespace {
+		return fmt.Errorf("component %s renders %s %s in the namespace %s, only the workspace's namespace is supported", component.Name, gvk.Kind, object.GetName(), object.GetNamespace())
+	}
+
+	object.Object = substitute(object.Object, replacer).(map[string]interface{})
+	object.SetNamespace(namespace)
+
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	for key, value := range r.labels(workspace, component) {
+		labels[key] = value
+	}
+
+	object.SetLabels(labels)
+
+	return r.secure(component, object)
+}
+
+// secure applies the component's security settings and the resource ceiling to the
+// pods of a rendered workload like it's done for the components running an image. The
+// pods can't share the namespaces of the node or mount its filesystem.
+func (r *renderedDeployer) secure(component *spot.ComponentSpec, object *unstructured.Unstructured) error {
+	fields, ok := podTemplateFields[object.GroupVersionKind().GroupKind()]
+	if !ok {
+		return nil
+	}
+
+	raw, found, err := unstructured.NestedMap(object.Object, fields...)
+	if err != nil || !found {
+		return err
+	}
+
+	owner := fmt.Sprintf("%s %s of component %s", strings.ToLower(object.GetKind()), object.GetName(), component.Name)
+
+	var template core.PodTemplateSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &template); err != nil {
+		return fmt.Errorf("invalid pod template for %s: %w", owner, err)
+	}
+
+	spec := &template.Spec
+	if spec.HostNetwork || spec.HostPID || spec.HostIPC {
+		return fmt.Errorf("%s can't share the namespaces of the node", owner)
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			return fmt.Errorf("%s can't mount %s from the node", owner, volume.HostPath.Path)
+		}
+	}
+
+	settings := component.RuntimeSpec.Merge(r.Defaults)
+	if context := settings.Security.PodSecurityContext(); context != nil {
+		if spec.SecurityContext == nil {
+			spec.SecurityContext = &core.PodSecurityContext{}
+		}
+
+		spec.SecurityContext.FSGroup = context.FSGroup
+	}
+
+	for _, containers := range [][]core.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			container := &containers[i]
+			container.SecurityContext = securityContext(container.SecurityContext, settings.Security)
+
+			resources, err := r.limit(fmt.Sprintf("container %s of %s", container.Name, owner), container.Resources.DeepCopy())
+			if err != nil {
+				return err
+			}
+
+			if resources != nil {
+				container.Resources = *resources
+			}
+		}
+	}
+
+	converted, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&template)
+	if err != nil {
+		return err
+	}
+
+	return unstructured.SetNestedMap(object.Object, converted, fields...)
+}
+
+// securityContext returns the security context of a rendered container. The component's
+// settings win and the ones it doesn't set are kept from the rendered container as long
+// as they don't give the container more privileges.
+func securityContext(rendered *core.SecurityContext, security *spot.SecuritySpec) *core.SecurityContext {
+	context := security.SecurityContext()
+	if rendered == nil {
+		return context
+	}
+
+	if context.RunAsUser == nil {
+		context.RunAsUser = rendered.RunAsUser
+	}
+
+	if context.RunAsGroup == nil {
+		context.RunAsGroup = rendered.RunAsGroup
+	}
+
+	if context.ReadOnlyRootFilesystem == nil {
+		context.ReadOnlyRootFilesystem = rendered.ReadOnlyRootFilesystem
+	}
+
+	context.SeccompProfile = rendered.SeccompProfile
+	if rendered.Capabilities != nil && len(rendered.Capabilities.Drop) != 0 {
+		context.Capabilities = &core.Capabilities{Drop: rendered.Capabilities.Drop}
+	}
+
+	return context
+}
+
+// claim makes sure the object doesn't already exist for another component or for
+// something else than a component, applying it would take the object over.
+func (r *renderedDeployer) claim(ctx context.Context, component *spot.ComponentSpec, object *unstructured.Unstructured) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(object.GroupVersionKind())
+
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(object), existing); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	owner, found := existing.GetLabels()[spot.ComponentLabel]
+	if !found {
+		return fmt.Errorf("component %s renders %s %s which already exists and doesn't belong to a component", component.Name, object.GetKind(), object.GetName())
+	}
+
+	if owner != component.Name {
+		return fmt.Errorf("component %s renders %s %s which belongs to component %s", component.Name, object.GetKind(), object.GetName(), owner)
+	}
+
+	return nil
+}
+
+// desired returns the objects that were rendered when the component was last deployed.
+func (r *renderedDeployer) desired(workspace *spot.Workspace, component *spot.ComponentSpec) ([]string, error) {
+	var desired []string
+	for _, reference := range workspace.Status.Components[component.Name].Objects {
+		desired = append(desired, reference.Kind+"/"+reference.Name)
+	}
+
+	return desired, nil
+}
+
+// started returns true once all the workloads of the component are ready.
+func (r *renderedDeployer) started(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (bool, error) {
+	notReady, err := r.notReady(ctx, workspace, component)
+	return notReady == nil, err
+}
+
+// notReady reports the first workload of the component that isn't ready. The objects
+// other than Deployments, StatefulSets and Jobs are ready once applied.
+func (r *renderedDeployer) notReady(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (*notReadyComponent, error) {
+	for _, reference := range workspace.Status.Components[component.Name].Objects {
+		reason, failed, err := r.workloadNotReady(ctx, reference)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(reason) != 0 {
+			return &notReadyComponent{name: component.Name, reason: reason, failed: failed}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// workloadNotReady returns why the workload isn't ready, it's empty when it's
+// ready. The workload failed when it won't ever be ready, ie. a Job that failed.
+func (r *renderedDeployer) workloadNotReady(ctx context.Context, reference spot.ResourceReference) (string, bool, error) {
+	key := client.ObjectKey{Namespace: reference.Namespace, Name: reference.Name}
+	get := func(object client.Object) (bool, error) {
+		if err := r.Client.Get(ctx, key, object); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	replicas := func(replicas *int32) int32 {
+		if replicas == nil {
+			return 1
+		}
+
+		return *replicas
+	}
+
+	switch schema.FromAPIVersionAndKind(reference.APIVersion, reference.Kind).GroupKind() {
+	case schema.GroupKind{Group: "apps", Kind: "Deployment"}:
+		var deployment apps.Deployment
+		if found, err := get(&deployment); !found || err != nil {
+			return fmt.Sprintf("deployment %s not found", reference.Name), false, err
+		}
+
+		if reason, failed := rolloutNotReady(&deployment); len(reason) != 0 {
+			return fmt.Sprintf("deployment %s: %s", reference.Name, reason), failed, nil
+		}
+	case schema.GroupKind{Group: "apps", Kind: "StatefulSet"}:
+		var statefulSet apps.StatefulSet
+		if found, err := get(&statefulSet); !found || err != nil {
+			return fmt.Sprintf("statefulset %s not found", reference.Name), false, err
+		}
+
+		desired := replicas(statefulSet.Spec.Replicas)
+		if statefulSet.Status.ObservedGeneration < statefulSet.Generation || statefulSet.Status.ReadyReplicas < desired {
+			return fmt.Sprintf("statefulset %s has %d/%d replicas ready", reference.Name, statefulSet.Status.ReadyReplicas, desired), false, nil
+		}
+	case schema.GroupKind{Group: "batch", Kind: "Job"}:
+		var job batch.Job
+		if found, err := get(&job); !found || err != nil {
+			return fmt.Sprintf("job %s not found", reference.Name), false, err
+		}
+
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != core.ConditionTrue {
+				continue
+			}
+
+			switch condition.Type {
+			case batch.JobComplete:
+				return "", false, nil
+			case batch.JobFailed:
+				failure, err := r.jobFailure(ctx, &job)
+				return fmt.Sprintf("job %s failed: %s", reference.Name, failure), true, err
+			}
+		}
+
+		return fmt.Sprintf("job %s didn't complete yet", reference.Name), false, nil
+	}
+
+	return "", false, nil
+}
+
+// placeholders returns the replacer of the placeholders the strings of the rendered
+// objects and the values of the charts can use. The image is the component's image,
+// if it has one, and the environments are the ones linked to the component.
+func (d *Deployment) placeholders(workspace *spot.Workspace, component *spot.ComponentSpec) (*strings.Replacer, error) {
+	envs, err := d.environmentsForComponent(component, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := d.image(workspace, component)
+	if err != nil {
+		return nil, err
+	}
+
+	// ie. registry.io/my-org/my-image:main@sha256:...
+	repository, digest, _ := strings.Cut(image, "@")
+	tag := ""
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+
+	pairs := []string{
+		"{{workspace}}", workspace.Name,
+		"{{namespace}}", namespaceFor(workspace),
+		"{{image}}", image,
+		"{{image.repository}}", repository,
+		"{{image.tag}}", tag,
+		"{{image.digest}}", digest,
+	}
+
+	for _, env := range envs {
+		pairs = append(pairs, fmt.Sprintf("{{env:%s}}", env.Name), env.Value)
+	}
+
+	return strings.NewReplacer(pairs...), nil
+}
+
+// substitute replaces the placeholders of every string of the value, the
+// keys of the maps are left untouched.
+func substitute(value interface{}, replacer *strings.Replacer) interface{} {
+	switch v := value.(type) {
+	case string:
+		return replacer.Replace(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = substitute(item, replacer)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = substitute(item, replacer)
+		}
+	}
+
+	return value
+}
+
+// checkout fetches the workspace's repository at the commit its branch was resolved
+// to. It needs to be closed once the objects are rendered.
+func (d *Deployment) checkout(ctx context.Context, workspace *spot.Workspace) (*repository.Checkout, error) {
+	if len(workspace.Spec.Branch.URL) == 0 {
+		return nil, fmt.Errorf("workspace %s doesn't have a branch URL", workspace.Name)
+	}
+
+	if err := repository.Allow(workspace.Spec.Branch.URL, d.Repositories); err != nil {
+		return nil, err
+	}
+
+	if len(workspace.Status.Commit) == 0 {
+		return nil, fmt.Errorf("the branch of workspace %s couldn't be resolved to a commit", workspace.Name)
+	}
+
+	if d.Checkouts == nil {
+		return repository.Fetch(ctx, workspace.Spec.Branch.URL, workspace.Spec.Branch.Name, workspace.Status.Commit)
+	}
+
+	return d.Checkouts.Checkout(ctx, workspace.Spec.Branch.URL, workspace.Status.Commit)
+}
+
+// decodeObjects reads the objects of a stream of YAML documents or JSON objects.
+// Empty documents are skipped and lists are flattened.
+func decodeObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var content map[string]interface{}
+		if err := decoder.Decode(&content); err != nil {
+			if err == io.EOF {
+				return objects, nil
+			}
+
+			return nil, err
+		}
+
+		if len(content) == 0 {
+			continue
+		}
+
+		object := &unstructured.Unstructured{Object: content}
+		if len(object.GetAPIVersion()) == 0 || len(object.GetKind()) == 0 {
+			return nil, fmt.Errorf("object %q doesn't have an apiVersion and a kind", object.GetName())
+		}
+
+		if !object.IsList() {
+			objects = append(objects, object)
+			continue
+		}
+
+		err := object.EachListItem(func(item runtime.Object) error {
+			objects = append(objects, item.(*unstructured.Unstructured))
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// deleteObjects removes the objects rendered for a component. The objects that are
+// already gone, or whose kind isn't served anymore, are skipped. It returns the
+// objects that were removed.
+func deleteObjects(ctx context.Context, c client.Client, references []spot.ResourceReference) ([]spot.ResourceReference, error) {
+	var deleted []spot.ResourceReference
+
+	for _, reference := range references {
+		object := &unstructured.Unstructured{}
+		object.SetAPIVersion(reference.APIVersion)
+		object.SetKind(reference.Kind)
+		object.SetNamespace(reference.Namespace)
+		object.SetName(reference.Name)
+
+		if err := c.Delete(ctx, object, client.PropagationPolicy("Background")); err != nil {
+			if k8sErrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+				continue
+			}
+
+			return deleted, err
+		}
+
+		deleted = append(deleted, reference)
+	}
+
+	return deleted, nil
+}
+
+// componentObjects returns the objects rendered for every component of the
+// workspace, sorted by component so they are always removed in the same order.
+func componentObjects(workspace *spot.Workspace) []spot.ResourceReference {
+	var names []string
+	for name := range workspace.Status.Components {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var references []spot.ResourceReference
+	for _, name := range names {
+		references = append(references, workspace.Status.Components[name].Objects...)
+	}
+
+	return references
+}
+
+// referenceKey identifies the object regardless of the version of its API.
+func referenceKey(reference spot.ResourceReference) string {
+	groupKind := schema.FromAPIVersionAndKind(reference.APIVersion, reference.Kind).GroupKind()
+	return fmt.Sprintf("%s/%s/%s", groupKind.String(), reference.Namespace, reference.Name)
+}
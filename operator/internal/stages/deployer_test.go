@@ -0,0 +1,355 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+func TestDecodeObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		err     bool
+	}{
+		{
+			name: "yaml documents",
+			content: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+# Comments only
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`,
+			want: []string{"ConfigMap/config", "Deployment/web"},
+		},
+		{
+			name:    "json",
+			content: `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "web"}}`,
+			want:    []string{"Service/web"},
+		},
+		{
+			name: "list",
+			content: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: web
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: credentials
+`,
+			want: []string{"Service/web", "Secret/credentials"},
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name: "without a kind",
+			content: `apiVersion: v1
+metadata:
+  name: web
+`,
+			err: true,
+		},
+		{
+			name:    "invalid yaml",
+			content: "apiVersion: v1\nkind: [",
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := decodeObjects(strings.NewReader(tt.content))
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, object := range objects {
+				got = append(got, object.GetKind()+"/"+object.GetName())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	replacer := strings.NewReplacer("{{workspace}}", "my-workspace", "{{env:HOST}}", "example.com")
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{
+			name:  "string",
+			value: "{{workspace}}.{{env:HOST}}",
+			want:  "my-workspace.example.com",
+		},
+		{
+			name:  "unknown placeholder",
+			value: "{{env:OTHER}}",
+			want:  "{{env:OTHER}}",
+		},
+		{
+			name: "nested values",
+			value: map[string]interface{}{
+				"host":     "{{env:HOST}}",
+				"replicas": int64(2),
+				"enabled":  true,
+				"hosts":    []interface{}{"{{workspace}}", map[string]interface{}{"name": "{{workspace}}"}},
+			},
+			want: map[string]interface{}{
+				"host":     "example.com",
+				"replicas": int64(2),
+				"enabled":  true,
+				"hosts":    []interface{}{"my-workspace", map[string]interface{}{"name": "my-workspace"}},
+			},
+		},
+		{
+			name:  "keys are left untouched",
+			value: map[string]interface{}{"{{workspace}}": "{{workspace}}"},
+			want:  map[string]interface{}{"{{workspace}}": "my-workspace"},
+		},
+		{
+			name:  "nil",
+			value: nil,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := substitute(tt.value, replacer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "role",
+			content: `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: admin
+`,
+		},
+		{
+			name: "daemon set",
+			content: `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+`,
+		},
+		{
+			name: "service account token",
+			content: `apiVersion: v1
+kind: Secret
+type: kubernetes.io/service-account-token
+metadata:
+  name: token
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := decodeObjects(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			deployer := &renderedDeployer{Deployment: &Deployment{}}
+			if err := deployer.prepare(&spot.Workspace{}, &spot.ComponentSpec{Name: "web"}, objects[0], strings.NewReplacer()); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestSecure(t *testing.T) {
+	const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      %s
+      initContainers:
+      - name: migrate
+        image: web
+      containers:
+      - name: web
+        image: web
+        securityContext:
+          privileged: true
+          runAsUser: 1001
+          capabilities:
+            add: ["NET_ADMIN"]
+            drop: ["ALL"]
+        resources:
+          limits:
+            memory: %s
+`
+
+	runAsRoot := true
+	tests := []struct {
+		name     string
+		pod      string
+		memory   string
+		security *spot.SecuritySpec
+		err      bool
+	}{
+		{name: "defaults", memory: "1Gi"},
+		{name: "component running as root", memory: "1Gi", security: &spot.SecuritySpec{RunAsRoot: &runAsRoot}},
+		{name: "more memory than the ceiling", memory: "4Gi", err: true},
+		{name: "host network", pod: "hostNetwork: true", memory: "1Gi", err: true},
+		{name: "host path", pod: "volumes: [{name: root, hostPath: {path: /}}]", memory: "1Gi", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := decodeObjects(strings.NewReader(fmt.Sprintf(deployment, tt.pod, tt.memory)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			deployer := &renderedDeployer{Deployment: &Deployment{MaxResources: core.ResourceList{core.ResourceMemory: resource.MustParse("2Gi")}}}
+			component := &spot.ComponentSpec{Name: "web", RuntimeSpec: spot.RuntimeSpec{Security: tt.security}}
+
+			err = deployer.secure(component, objects[0])
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var rendered apps.Deployment
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(objects[0].Object, &rendered); err != nil {
+				t.Fatal(err)
+			}
+
+			want := core.Container{
+				Name:  "web",
+				Image: "web",
+				SecurityContext: &core.SecurityContext{
+					RunAsNonRoot:             boolPtr(tt.security == nil),
+					AllowPrivilegeEscalation: boolPtr(false),
+					RunAsUser:                int64Ptr(1001),
+					Capabilities:             &core.Capabilities{Drop: []core.Capability{"ALL"}},
+				},
+				Resources: core.ResourceRequirements{Limits: core.ResourceList{core.ResourceMemory: resource.MustParse("1Gi")}},
+			}
+
+			if got := rendered.Spec.Template.Spec.Containers[0]; !equality.Semantic.DeepEqual(got, want) {
+				t.Errorf("got container %+v, want %+v", got, want)
+			}
+
+			init := rendered.Spec.Template.Spec.InitContainers[0]
+			if limit := init.Resources.Limits[core.ResourceMemory]; limit.String() != "2Gi" || init.SecurityContext == nil {
+				t.Errorf("got init container %+v, want it limited and secured", init)
+			}
+		})
+	}
+}
+
+func TestClaim(t *testing.T) {
+	config := func(name string, labels map[string]string) *core.ConfigMap {
+		return &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "spot-shop", Labels: labels}}
+	}
+
+	c := fake.NewClientBuilder().WithObjects(
+		config("web", map[string]string{spot.ComponentLabel: "web"}),
+		config("api", map[string]string{spot.ComponentLabel: "api"}),
+		config("kube-root-ca.crt", nil),
+	).Build()
+
+	deployer := &renderedDeployer{Deployment: &Deployment{Client: c}}
+
+	tests := []struct {
+		name string
+		err  bool
+	}{
+		{name: "web"},
+		{name: "missing"},
+		{name: "api", err: true},
+		{name: "kube-root-ca.crt", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := &unstructured.Unstructured{}
+			object.SetAPIVersion("v1")
+			object.SetKind("ConfigMap")
+			object.SetNamespace("spot-shop")
+			object.SetName(tt.name)
+
+			err := deployer.claim(context.Background(), &spot.ComponentSpec{Name: "web"}, object)
+			if tt.err && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
@@ -2,163 +2,1052 @@ package stages
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gateway "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/releasehub-com/spot/operator/internal/repository"
+	"github.com/releasehub-com/spot/operator/internal/routing"
 )
 
+// Field manager of the objects applied for the components. The operator owns
+// every field it sets and takes them over from other managers when applying.
+const fieldOwner = client.FieldOwner("spot")
+
 type Deployment struct {
 	client.Client
+
+	// How long the components have to become ready once deployed.
+	ReadyTimeout time.Duration
+
+	// Settings of the ingresses, already merged with the project's.
+	Ingress spot.IngressSpec
+
+	// Resources, scheduling and security settings of the components
+	// that don't set their own, usually the project's.
+	Defaults *spot.RuntimeSpec
+
+	// Most a container can request or be limited to. Containers
+	// without a limit are limited to it.
+	MaxResources core.ResourceList
+
+	// Hosts the Helm charts can be downloaded from. A
+	// leading "*." allows any subdomain of the host.
+	ChartRepositories []string
+
+	// Hosts the repositories of the workspaces can be fetched from, with
+	// the same syntax as ChartRepositories.
+	Repositories []string
+
+	// Checkouts of the repositories, shared across the workspaces. The
+	// repositories are fetched every time they are needed if it's not set.
+	Checkouts *repository.Cache
 }
 
+// Start deploys the components of the workspace in the order of their dependencies. The
+// workspace stays in the Deploying stage until every component is deployed and ready, it's
+// up to the reconciler to call Start again until it's the case. The workspace errors out
+// if a component is still not ready once the ReadyTimeout is exceeded.
 func (d *Deployment) Start(ctx context.Context, workspace *spot.Workspace) error {
-	services := make(map[string]*core.Service)
+	if err := d.validate(workspace); err != nil {
+		workspace.SetStage(spot.WorkspaceStageError, err.Error())
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	waiting, err := d.deploy(ctx, workspace, workspace.Spec.Components)
+	if err != nil {
+		return err
+	}
+
+	// A job that failed holds its dependents forever, the
+	// failure is reported even if components are still waiting.
+	notReady, err := d.notReady(ctx, workspace, workspace.Spec.Components)
+	if err != nil {
+		return err
+	}
+
+	if d.failed(workspace, notReady) {
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	if waiting {
+		workspace.SetCondition(spot.WorkspaceConditionDeployed, meta.ConditionFalse, spot.ReasonWaitingOnDependencies, d.waitingMessage(workspace))
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	if len(notReady) != 0 {
+		d.setNotReady(workspace, notReady)
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	workspace.SetCondition(spot.WorkspaceConditionDeployed, meta.ConditionTrue, spot.ReasonDeployed, fmt.Sprintf("%d components deployed", len(workspace.Spec.Components)))
+	workspace.SetStage(spot.WorkspaceStageRunning, "")
+
+	return d.Client.SubResource("status").Update(ctx, workspace)
+}
+
+// Update rolls out the components that changed since they were last deployed and removes
+// the ones that are not part of the workspace anymore. Components that didn't change
+// are left running untouched. Like Start, the workspace stays in its stage while
+// some of the components are waiting on their dependencies or until every
+// component is ready again, including the jobs that run again.
+func (d *Deployment) Update(ctx context.Context, workspace *spot.Workspace) error {
+	logger := log.FromContext(ctx)
 
+	if err := d.validate(workspace); err != nil {
+		workspace.SetStage(spot.WorkspaceStageError, err.Error())
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	var changed, rollout []spot.ComponentSpec
 	for _, component := range workspace.Spec.Components {
-		service := core.Service{
-			ObjectMeta: meta.ObjectMeta{
-				Name:      component.Name,
-				Namespace: workspace.Namespace,
-				OwnerReferences: []meta.OwnerReference{
-					{
-						APIVersion: workspace.APIVersion,
-						Kind:       workspace.Kind,
-						Name:       workspace.Name,
-						UID:        workspace.UID,
-					},
-				},
-			},
-			Spec: core.ServiceSpec{
-				Selector: map[string]string{
-					"app.kubernetes.io/name": component.Name,
-				},
-				Ports: []core.ServicePort{
-					{
-						Name:       component.Name,
-						Port:       int32(component.Services[0].Port),
-						TargetPort: intstr.FromInt(component.Services[0].Port),
-					},
-				},
-			},
+		hash, err := d.componentHash(&component, workspace)
+		if err != nil {
+			return err
 		}
 
-		if err := d.Client.Create(ctx, &service); err != nil {
-			return err
+		status, ok := workspace.Status.Components[component.Name]
+		if ok && status.Hash == hash {
+			continue
 		}
 
-		services[component.Name] = &service
-
-		if len(component.Services[0].Ingress) != 0 {
-			ingressClassName := "nginx"
-			pathType := networking.PathTypePrefix
-
-			ingress := &networking.Ingress{
-				ObjectMeta: meta.ObjectMeta{
-					Name:      "click-mania",
-					Namespace: workspace.Namespace,
-					OwnerReferences: []meta.OwnerReference{
-						{
-							APIVersion: workspace.APIVersion,
-							Kind:       workspace.Kind,
-							Name:       workspace.Name,
-							UID:        workspace.UID,
-						},
-					},
-				},
-				Spec: networking.IngressSpec{
-					IngressClassName: &ingressClassName,
-					Rules: []networking.IngressRule{{
-						Host: "click-mania.po.ngrok.app",
-						IngressRuleValue: networking.IngressRuleValue{
-							HTTP: &networking.HTTPIngressRuleValue{
-								Paths: []networking.HTTPIngressPath{{
-									Path:     "/",
-									PathType: &pathType,
-									Backend: networking.IngressBackend{
-										Service: &networking.IngressServiceBackend{
-											Name: services["click-mania"].Name,
-											Port: networking.ServiceBackendPort{Number: services["click-mania"].Spec.Ports[0].Port},
-										},
-									},
-								}},
-							},
-						},
-					}},
-				},
-			}
+		// Components waiting on their dependencies were never deployed.
+		if ok && len(status.Hash) != 0 {
+			rollout = append(rollout, component)
+		}
+
+		changed = append(changed, component)
+	}
 
-			if err := d.Client.Create(ctx, ingress); err != nil {
+	// The objects of the removed components are pruned by deploy, except
+	// for the objects rendered from their manifests which are only
+	// known from their status.
+	for name, status := range workspace.Status.Components {
+		if d.component(workspace, name) == nil {
+			logger.Info("removing component", "component", name)
+			if _, err := deleteObjects(ctx, d.Client, status.Objects); err != nil {
 				return err
 			}
 
+			d.removeRoutes(workspace, name)
+			delete(workspace.Status.Components, name)
 		}
 	}
 
+	// The workloads of the components are updated in place when they are
+	// deployed again. The rendered objects are kept so the ones that are
+	// not rendered anymore are removed once the component is deployed.
+	for _, component := range rollout {
+		logger.Info("rolling out component", "component", component.Name)
+		workspace.Status.Components[component.Name] = spot.ComponentStatus{Objects: workspace.Status.Components[component.Name].Objects}
+	}
+
+	waiting, err := d.deploy(ctx, workspace, changed)
+	if err != nil {
+		return err
+	}
+
+	notReady, err := d.notReady(ctx, workspace, workspace.Spec.Components)
+	if err != nil {
+		return err
+	}
+
+	if d.failed(workspace, notReady) {
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	if waiting {
+		workspace.SetCondition(spot.WorkspaceConditionDeployed, meta.ConditionFalse, spot.ReasonWaitingOnDependencies, d.waitingMessage(workspace))
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	if len(notReady) != 0 {
+		d.setNotReady(workspace, notReady)
+		return d.Client.SubResource("status").Update(ctx, workspace)
+	}
+
+	workspace.SetCondition(spot.WorkspaceConditionDeployed, meta.ConditionTrue, spot.ReasonDeployed, fmt.Sprintf("%d components rolled out", len(changed)))
+	workspace.SetStage(spot.WorkspaceStageRunning, "")
+
+	return d.Client.SubResource("status").Update(ctx, workspace)
+}
+
+// validate checks the spec of the workspace along with the
+// resources of its components against the ceiling.
+func (d *Deployment) validate(workspace *spot.Workspace) error {
+	if err := workspace.Spec.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := routing.New(d.Ingress); err != nil {
+		return err
+	}
+
 	for _, component := range workspace.Spec.Components {
-		envs, err := d.environmentsForComponent(&component, workspace)
-		if err != nil {
+		if _, err := d.resources(&component); err != nil {
 			return err
 		}
 
-		pod := core.Pod{
-			ObjectMeta: meta.ObjectMeta{
-				GenerateName: fmt.Sprintf("%s-", component.Name),
-				Namespace:    workspace.Namespace,
-				Labels: map[string]string{
-					"app.kubernetes.io/name": component.Name,
-				},
-				OwnerReferences: []meta.OwnerReference{
-					{
-						APIVersion: workspace.APIVersion,
-						Kind:       workspace.Kind,
-						Name:       workspace.Name,
-						UID:        workspace.UID,
-					},
-				},
+		for _, container := range component.Containers() {
+			if _, err := d.limit(fmt.Sprintf("container %s of component %s", container.Name, component.Name), container.Resources.DeepCopy()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Retry removes whatever was deployed before the workspace errored
+// and moves it back to the Deploying stage.
+func (d *Deployment) Retry(ctx context.Context, workspace *spot.Workspace) error {
+	for _, component := range workspace.Spec.Components {
+		if err := d.remove(ctx, workspace, component.Name); err != nil {
+			return err
+		}
+	}
+
+	workspace.Status.Components = nil
+	workspace.SetStage(spot.WorkspaceStageDeploying, "")
+
+	return d.Client.SubResource("status").Update(ctx, workspace)
+}
+
+// deploy applies all the objects for the components and records them in the
+// workspace's status. The services are all applied before any of
+// the pods so the pods can reach each other as they boot.
+//
+// The pods are created in the order of the dependencies and a component is held
+// until all the components it depends on are ready. Components that are already
+// deployed are skipped so deploy can be called until nothing is waiting anymore.
+// Every object is applied with server-side apply, so deploying the same component
+// again after a partial failure is safe.
+func (d *Deployment) deploy(ctx context.Context, workspace *spot.Workspace, components []spot.ComponentSpec) (bool, error) {
+	sorted, err := spot.SortComponents(workspace.Spec.Components)
+	if err != nil {
+		return false, err
+	}
+
+	if err := d.prune(ctx, workspace); err != nil {
+		return false, err
+	}
+
+	selected := make(map[string]bool)
+	for _, component := range components {
+		if err := d.deployer(&component).deployServices(ctx, workspace, &component); err != nil {
+			return false, err
+		}
+
+		selected[component.Name] = true
+	}
+
+	if workspace.Status.Components == nil {
+		workspace.Status.Components = make(map[string]spot.ComponentStatus)
+	}
+
+	waiting := false
+	for _, component := range sorted {
+		if !selected[component.Name] {
+			continue
+		}
+
+		if status, ok := workspace.Status.Components[component.Name]; ok && len(status.Hash) != 0 {
+			continue
+		}
+
+		pending, err := d.pendingDependencies(ctx, workspace, &component)
+		if err != nil {
+			return false, err
+		}
+
+		if len(pending) != 0 {
+			workspace.Status.Components[component.Name] = spot.ComponentStatus{WaitingOn: pending, Objects: workspace.Status.Components[component.Name].Objects}
+			waiting = true
+			continue
+		}
+
+		objects, err := d.deployer(&component).deployWorkload(ctx, workspace, &component)
+		if err != nil {
+			return false, err
+		}
+
+		hash, err := d.componentHash(&component, workspace)
+		if err != nil {
+			return false, err
+		}
+
+		image, err := d.image(workspace, &component)
+		if err != nil {
+			return false, err
+		}
+
+		workspace.Status.Components[component.Name] = spot.ComponentStatus{Hash: hash, Image: image, Objects: objects}
+	}
+
+	if _, err := d.refreshReplicas(ctx, workspace); err != nil {
+		return false, err
+	}
+
+	return waiting, d.refreshVolumes(ctx, workspace)
+}
+
+// pendingDependencies returns the dependencies of the component that are not
+// deployed yet or that are not started. Jobs need to have succeeded.
+func (d *Deployment) pendingDependencies(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]string, error) {
+	var pending []string
+
+	for _, dependency := range component.DependsOn {
+		if status, ok := workspace.Status.Components[dependency]; !ok || len(status.Hash) == 0 {
+			pending = append(pending, dependency)
+			continue
+		}
+
+		spec := d.component(workspace, dependency)
+		started, err := d.deployer(spec).started(ctx, workspace, spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if !started {
+			pending = append(pending, dependency)
+		}
+	}
+
+	return pending, nil
+}
+
+func (d *Deployment) waitingMessage(workspace *spot.Workspace) string {
+	var names []string
+	for name := range workspace.Status.Components {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var messages []string
+	for _, name := range names {
+		if waitingOn := workspace.Status.Components[name].WaitingOn; len(waitingOn) != 0 {
+			messages = append(messages, fmt.Sprintf("%s is waiting on %s", name, strings.Join(waitingOn, ", ")))
+		}
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+type notReadyComponent struct {
+	name   string
+	reason string
+
+	// The component won't ever be ready, ie. a job that failed.
+	failed bool
+
+	// The workload of the component tells on its own when it's not ready
+	// in time, ie. a Deployment reporting it's past its progress deadline.
+	deadline bool
+}
+
+// notReady returns the components that are not ready, ie. the ones that don't have all
+// their replicas ready or the jobs that didn't succeed, along with the reason sorted by name.
+func (d *Deployment) notReady(ctx context.Context, workspace *spot.Workspace, components []spot.ComponentSpec) ([]notReadyComponent, error) {
+	var notReady []notReadyComponent
+
+	for _, component := range components {
+		reason, err := d.deployer(&component).notReady(ctx, workspace, &component)
+		if err != nil {
+			return nil, err
+		}
+
+		if reason != nil {
+			notReady = append(notReady, *reason)
+		}
+	}
+
+	sort.Slice(notReady, func(i, j int) bool {
+		return notReady[i].name < notReady[j].name
+	})
+
+	return notReady, nil
+}
+
+// failed moves the workspace to the Error stage when one of
+// the components failed and can't become ready anymore.
+func (d *Deployment) failed(workspace *spot.Workspace, notReady []notReadyComponent) bool {
+	for _, component := range notReady {
+		if component.failed {
+			workspace.SetStage(spot.WorkspaceStageError, fmt.Sprintf("Component %s failed: %s", component.name, component.reason))
+			return true
+		}
+	}
+
+	return false
+}
+
+// setNotReady records why the components are not ready. The workspace errors
+// out once they are still not ready after the ReadyTimeout. Components whose
+// workload has its own deadline are left to it, the stage can be older
+// than their rollout.
+func (d *Deployment) setNotReady(workspace *spot.Workspace, notReady []notReadyComponent) {
+	var messages []string
+	for _, component := range notReady {
+		messages = append(messages, fmt.Sprintf("%s is not ready: %s", component.name, component.reason))
+	}
+
+	workspace.SetCondition(spot.WorkspaceConditionDeployed, meta.ConditionFalse, spot.ReasonComponentsNotReady, strings.Join(messages, "; "))
+
+	if workspace.Status.StageTransitionTime == nil || time.Since(workspace.Status.StageTransitionTime.Time) <= d.ReadyTimeout {
+		return
+	}
+
+	for _, failed := range notReady {
+		if !failed.deadline {
+			workspace.SetStage(spot.WorkspaceStageError, fmt.Sprintf("Component %s is not ready after %s: %s", failed.name, d.ReadyTimeout, failed.reason))
+			return
+		}
+	}
+}
+
+// podFailure describes why the pod is not ready from the state of its
+// containers or from its scheduling. A container that terminated comes
+// with the end of its logs when it didn't write a termination message.
+func podFailure(pod *core.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil && len(waiting.Reason) != 0 {
+			if len(waiting.Message) != 0 {
+				return fmt.Sprintf("%s: %s", waiting.Reason, waiting.Message)
+			}
+
+			return waiting.Reason
+		}
+
+		if terminated := status.State.Terminated; terminated != nil {
+			if message := strings.TrimSpace(terminated.Message); len(message) != 0 {
+				return fmt.Sprintf("%s (exit code %d): %s", terminated.Reason, terminated.ExitCode, message)
+			}
+
+			return fmt.Sprintf("%s (exit code %d)", terminated.Reason, terminated.ExitCode)
+		}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core.PodScheduled && condition.Status == core.ConditionFalse {
+			return fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+
+	return "readiness check is failing"
+}
+
+// rolloutNotReady returns why the rollout of the Deployment isn't complete. It's empty
+// once every replica runs the latest template and is available, and the replicas
+// of the previous templates are gone. Pods are not counted directly as the ones
+// of the previous templates would be counted with the new ones. The rollout failed
+// once it didn't progress within the Deployment's progress deadline.
+func rolloutNotReady(deployment *apps.Deployment) (string, bool) {
+	reason := rolloutProgress(deployment)
+	if len(reason) == 0 {
+		return "", false
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == apps.DeploymentProgressing && condition.Status == core.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			return fmt.Sprintf("%s, %s", reason, condition.Message), true
+		}
+	}
+
+	return reason, false
+}
+
+func rolloutProgress(deployment *apps.Deployment) string {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+
+	status := deployment.Status
+	switch {
+	case status.ObservedGeneration < deployment.Generation:
+		return "rollout didn't start yet"
+	case status.UpdatedReplicas < desired:
+		return fmt.Sprintf("%d/%d replicas updated", status.UpdatedReplicas, desired)
+	case status.Replicas > status.UpdatedReplicas:
+		return fmt.Sprintf("%d old replicas pending termination", status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < desired:
+		return fmt.Sprintf("%d/%d replicas available", status.AvailableReplicas, desired)
+	}
+
+	return ""
+}
+
+func podReady(pod *core.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core.PodReady {
+			return condition.Status == core.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// deployService exposes every port of the component on a service named after the
+// component, along with the ingresses of the ports that set one. Components
+// without any port don't have a service.
+func (d *Deployment) deployService(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error {
+	if len(component.AllServices()) == 0 {
+		return d.deployRoutes(ctx, workspace, component)
+	}
+
+	service := &core.Service{
+		TypeMeta: meta.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: meta.ObjectMeta{
+			Name:      component.Name,
+			Namespace: namespaceFor(workspace),
+			Labels:    d.labels(workspace, component),
+		},
+		Spec: core.ServiceSpec{
+			Selector: map[string]string{
+				"app.kubernetes.io/name": component.Name,
 			},
-			Spec: core.PodSpec{
-				RestartPolicy: core.RestartPolicyNever,
-				Containers: []core.Container{
-					{
-						Name:  component.Name,
-						Image: component.Image.Name,
-						Ports: []core.ContainerPort{
-							{
-								Name:          component.Services[0].Protocol,
-								HostPort:      int32(component.Services[0].Port),
-								ContainerPort: int32(component.Services[0].Port),
-							},
-						},
-						Env: envs,
-					},
+		},
+	}
+
+	for _, spec := range component.AllServices() {
+		protocol, appProtocol, err := spec.TransportProtocol()
+		if err != nil {
+			return err
+		}
+
+		service.Spec.Ports = append(service.Spec.Ports, core.ServicePort{
+			Name:        spec.PortName(),
+			Protocol:    protocol,
+			AppProtocol: appProtocol,
+			Port:        int32(spec.Port),
+			TargetPort:  intstr.FromString(spec.PortName()),
+		})
+	}
+
+	if err := d.apply(ctx, service); err != nil {
+		return err
+	}
+
+	return d.deployRoutes(ctx, workspace, component)
+}
+
+// setRoute records the route in the workspace's status, replacing
+// the existing route for the same host and path.
+func (d *Deployment) setRoute(workspace *spot.Workspace, route spot.RouteStatus) {
+	for i := range workspace.Status.Routes {
+		if workspace.Status.Routes[i].Host == route.Host && workspace.Status.Routes[i].Path == route.Path {
+			workspace.Status.Routes[i] = route
+			return
+		}
+	}
+
+	workspace.Status.Routes = append(workspace.Status.Routes, route)
+}
+
+// deployWorkload applies the workload of the component, a Job for the components that
+// run once and a Deployment otherwise. The Deployment is named after the component
+// so deploying it again rolls out the changes in place.
+func (d *Deployment) deployWorkload(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error {
+	template, err := d.podTemplate(workspace, component)
+	if err != nil {
+		return err
+	}
+
+	if component.IsJob() {
+		return d.deployJob(ctx, workspace, component, template)
+	}
+
+	deployment := &apps.Deployment{
+		TypeMeta: meta.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: meta.ObjectMeta{
+			Name:      component.Name,
+			Namespace: namespaceFor(workspace),
+			Labels:    d.labels(workspace, component),
+		},
+		Spec: apps.DeploymentSpec{
+			Replicas: component.GetReplicas(),
+			Selector: &meta.LabelSelector{
+				MatchLabels: map[string]string{
+					spot.WorkspaceLabel: workspace.Name,
+					spot.ComponentLabel: component.Name,
 				},
 			},
+			Template: *template,
+		},
+	}
+
+	// The volumes can only be attached to one node at a time, the old
+	// pod needs to be gone before the new one starts. Components with
+	// volumes are validated to run a single replica for the same reason.
+	if len(template.Spec.Volumes) != 0 {
+		deployment.Spec.Strategy = apps.DeploymentStrategy{Type: apps.RecreateDeploymentStrategyType}
+	}
+
+	// The rollout fails once it doesn't progress for as long as the
+	// components have to become ready.
+	if d.ReadyTimeout > 0 {
+		deadline := int32(d.ReadyTimeout.Seconds())
+		deployment.Spec.ProgressDeadlineSeconds = &deadline
+	}
+
+	// The replicas of autoscaled components are left out so
+	// the autoscaler is the only one setting them.
+	if component.Autoscaling != nil {
+		deployment.Spec.Replicas = nil
+	}
+
+	if err := d.apply(ctx, deployment); err != nil {
+		return err
+	}
+
+	if component.Autoscaling == nil {
+		return nil
+	}
+
+	return d.deployAutoscaler(ctx, workspace, component)
+}
+
+// podTemplate returns the pod running the component's container.
+func (d *Deployment) podTemplate(workspace *spot.Workspace, component *spot.ComponentSpec) (*core.PodTemplateSpec, error) {
+	envs, err := d.environmentsForComponent(component, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := d.image(workspace, component)
+	if err != nil {
+		return nil, err
+	}
+
+	podLabels := d.labels(workspace, component)
+	podLabels["app.kubernetes.io/name"] = component.Name
+
+	container := core.Container{
+		Name:           component.Name,
+		Image:          image,
+		Env:            envs,
+		ReadinessProbe: component.ReadinessProbe(),
+		LivenessProbe:  component.LivenessProbe(),
+
+		TerminationMessagePolicy: core.TerminationMessageFallbackToLogsOnError,
+	}
+
+	runtime := component.RuntimeSpec.Merge(d.Defaults)
+	container.SecurityContext = runtime.Security.SecurityContext()
+
+	resources, err := d.resources(component)
+	if err != nil {
+		return nil, err
+	}
+
+	if resources != nil {
+		container.Resources = *resources
+	}
+
+	volumes, mounts := d.volumes(component)
+	container.VolumeMounts = mounts
+
+	for _, service := range component.Services {
+		protocol, _, err := service.TransportProtocol()
+		if err != nil {
+			return nil, err
+		}
+
+		container.Ports = append(container.Ports, core.ContainerPort{
+			Name:          service.PortName(),
+			ContainerPort: int32(service.Port),
+			Protocol:      protocol,
+		})
+	}
+
+	if len(component.Command) != 0 {
+		container.Command = component.Command
+	}
+
+	template := &core.PodTemplateSpec{
+		ObjectMeta: meta.ObjectMeta{Labels: podLabels},
+		Spec: core.PodSpec{
+			Containers:         []core.Container{container},
+			NodeSelector:       runtime.NodeSelector,
+			Tolerations:        runtime.Tolerations,
+			Affinity:           runtime.Affinity,
+			ServiceAccountName: runtime.ServiceAccountName,
+			SecurityContext:    runtime.Security.PodSecurityContext(),
+			Volumes:            volumes,
+		},
+	}
+
+	for _, sidecar := range component.Sidecars {
+		container, err := d.container(workspace, component, &sidecar, &runtime)
+		if err != nil {
+			return nil, err
+		}
+
+		template.Spec.Containers = append(template.Spec.Containers, *container)
+	}
+
+	for _, init := range component.InitContainers {
+		container, err := d.container(workspace, component, &init, &runtime)
+		if err != nil {
+			return nil, err
+		}
+
+		template.Spec.InitContainers = append(template.Spec.InitContainers, *container)
+	}
+
+	return template, nil
+}
+
+// container returns one of the additional containers of the component. It runs
+// with the same security settings as the component's container.
+func (d *Deployment) container(workspace *spot.Workspace, component *spot.ComponentSpec, spec *spot.ContainerSpec, runtime *spot.RuntimeSpec) (*core.Container, error) {
+	owner := fmt.Sprintf("container %s of component %s", spec.Name, component.Name)
+
+	envs, err := d.environments(spec.Environments, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := d.reference(workspace, spec.Image, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	container := &core.Container{
+		Name:            spec.Name,
+		Image:           image,
+		Command:         spec.Command,
+		Env:             envs,
+		SecurityContext: runtime.Security.SecurityContext(),
+
+		TerminationMessagePolicy: core.TerminationMessageFallbackToLogsOnError,
+	}
+
+	resources, err := d.limit(owner, spec.Resources.DeepCopy())
+	if err != nil {
+		return nil, err
+	}
+
+	if resources != nil {
+		container.Resources = *resources
+	}
+
+	for _, service := range spec.Services {
+		protocol, _, err := service.TransportProtocol()
+		if err != nil {
+			return nil, err
+		}
+
+		container.Ports = append(container.Ports, core.ContainerPort{
+			Name:          service.PortName(),
+			ContainerPort: int32(service.Port),
+			Protocol:      protocol,
+		})
+	}
+
+	return container, nil
+}
+
+// resources returns the resources of the component's container merged with the defaults.
+// The limits that are not set default to the ceiling and an error is returned if
+// the container asks for more than the ceiling.
+func (d *Deployment) resources(component *spot.ComponentSpec) (*core.ResourceRequirements, error) {
+	return d.limit(fmt.Sprintf("component %s", component.Name), component.RuntimeSpec.Merge(d.Defaults).Resources)
+}
+
+// limit caps the resources of a container to the ceiling, the owner describes
+// the container in the error.
+func (d *Deployment) limit(owner string, resources *core.ResourceRequirements) (*core.ResourceRequirements, error) {
+	if len(d.MaxResources) == 0 {
+		return resources, nil
+	}
+
+	if resources == nil {
+		resources = &core.ResourceRequirements{}
+	}
+
+	if resources.Limits == nil {
+		resources.Limits = make(core.ResourceList)
+	}
+
+	for name, ceiling := range d.MaxResources {
+		if _, ok := resources.Limits[name]; !ok {
+			resources.Limits[name] = ceiling.DeepCopy()
 		}
 
-		if len(component.Command) != 0 {
-			pod.Spec.Containers[0].Command = component.Command
+		for _, list := range []core.ResourceList{resources.Requests, resources.Limits} {
+			if quantity, ok := list[name]; ok && quantity.Cmp(ceiling) > 0 {
+				return nil, fmt.Errorf("%s asks for %s of %s, the maximum is %s", owner, quantity.String(), name, ceiling.String())
+			}
 		}
+	}
+
+	return resources, nil
+}
+
+// apply creates or updates the object with server-side apply. The fields
+// the operator doesn't set anymore are removed from the object.
+func (d *Deployment) apply(ctx context.Context, object client.Object) error {
+	return d.Client.Patch(ctx, object, client.Apply, fieldOwner, client.ForceOwnership)
+}
 
-		if err := d.Client.Create(ctx, &pod); err != nil {
+// prune deletes the objects of the workspace that are not desired anymore, either
+// because their component was removed or because it doesn't expose the port or
+// mount the volume anymore. Volumes that are retained keep their data. The objects
+// rendered from manifests are desired as long as they were rendered the last
+// time their component was deployed.
+// Only the objects labeled with a component are considered, the ones the
+// other stages create for the workspace are left untouched.
+func (d *Deployment) prune(ctx context.Context, workspace *spot.Workspace) error {
+	logger := log.FromContext(ctx)
+
+	desired := make(map[string]bool)
+	for _, component := range workspace.Spec.Components {
+		objects, err := d.deployer(&component).desired(workspace, &component)
+		if err != nil {
 			return err
 		}
+
+		for _, object := range objects {
+			desired[object] = true
+		}
 	}
 
-	workspace.Status.Stage = spot.WorkspaceStageRunning
+	lists := []struct {
+		kind string
+		list client.ObjectList
+	}{
+		{"Service", &core.ServiceList{}},
+		{"Deployment", &apps.DeploymentList{}},
+		{"Job", &batch.JobList{}},
+		{"PersistentVolumeClaim", &core.PersistentVolumeClaimList{}},
+		{"HorizontalPodAutoscaler", &autoscaling.HorizontalPodAutoscalerList{}},
+	}
 
-	return d.Client.SubResource("status").Update(ctx, workspace)
+	// The routes of every backend are listed so the ones left
+	// behind when the backend changes are pruned as well.
+	for _, b := range routing.All(d.Ingress) {
+		lists = append(lists, struct {
+			kind string
+			list client.ObjectList
+		}{b.Kind(), b.List()})
+	}
+
+	for _, l := range lists {
+		if err := d.Client.List(ctx, l.list, client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name}, client.HasLabels{spot.ComponentLabel}); err != nil {
+			// The Gateway API might not be installed in the cluster.
+			if apimeta.IsNoMatchError(err) {
+				continue
+			}
+
+			return err
+		}
+
+		items, err := apimeta.ExtractList(l.list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			object, ok := item.(client.Object)
+			if !ok || desired[l.kind+"/"+object.GetName()] {
+				continue
+			}
+
+			if claim, ok := object.(*core.PersistentVolumeClaim); ok {
+				if err := retainVolume(ctx, d.Client, claim); err != nil {
+					return err
+				}
+			}
+
+			logger.Info("pruning", "kind", l.kind, "name", object.GetName())
+			if err := d.Client.Delete(ctx, object, client.PropagationPolicy("Background")); err != nil && !k8sErrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// remove deletes every object that belongs to the component along with its routes.
+func (d *Deployment) remove(ctx context.Context, workspace *spot.Workspace, name string) error {
+	if _, err := deleteObjects(ctx, d.Client, workspace.Status.Components[name].Objects); err != nil {
+		return err
+	}
+
+	opts := []client.DeleteAllOfOption{
+		client.InNamespace(namespaceFor(workspace)),
+		client.MatchingLabels{spot.WorkspaceLabel: workspace.Name, spot.ComponentLabel: name},
+	}
+
+	// The pods of the jobs are not removed with them otherwise.
+	opts = append(opts, client.PropagationPolicy("Background"))
+
+	for _, object := range []client.Object{&networking.Ingress{}, &gateway.HTTPRoute{}, &autoscaling.HorizontalPodAutoscaler{}, &apps.Deployment{}, &batch.Job{}} {
+		if err := d.Client.DeleteAllOf(ctx, object, opts...); err != nil && !apimeta.IsNoMatchError(err) {
+			return err
+		}
+	}
+
+	d.removeRoutes(workspace, name)
+
+	// Services don't support deletecollection.
+	var services core.ServiceList
+	if err := d.Client.List(ctx, &services, client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name, spot.ComponentLabel: name}); err != nil {
+		return err
+	}
+
+	for _, service := range services.Items {
+		if err := d.Client.Delete(ctx, &service); err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Deployment) removeRoutes(workspace *spot.Workspace, name string) {
+	var routes []spot.RouteStatus
+	for _, route := range workspace.Status.Routes {
+		if route.Component != name {
+			routes = append(routes, route)
+		}
+	}
+	workspace.Status.Routes = routes
+}
+
+// componentHash returns a hash of everything that requires the component
+// to be rolled out again when it changes.
+func (d *Deployment) componentHash(component *spot.ComponentSpec, workspace *spot.Workspace) (string, error) {
+	envs, err := d.environmentsForComponent(component, workspace)
+	if err != nil {
+		return "", err
+	}
+
+	image, err := d.image(workspace, component)
+	if err != nil {
+		return "", err
+	}
+
+	images := []string{image}
+	for _, container := range component.Containers() {
+		image, err := d.reference(workspace, container.Image, fmt.Sprintf("container %s of component %s", container.Name, component.Name))
+		if err != nil {
+			return "", err
+		}
+
+		images = append(images, image)
+	}
+
+	// The components deployed from the repository are rendered
+	// again when the branch moves to another commit.
+	var commit string
+	if component.FromRepository() {
+		commit = workspace.Status.Commit
+	}
+
+	// The defaults are part of the hash so the components
+	// are rolled out when the project's defaults change.
+	content, err := json.Marshal(struct {
+		Component *spot.ComponentSpec
+		Envs      []core.EnvVar
+		Images    []string
+		Runtime   spot.RuntimeSpec
+		Commit    string `json:",omitempty"`
+	}{component, envs, images, component.RuntimeSpec.Merge(d.Defaults), commit})
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// image returns the image the component runs. Images built for the workspace
+// are referenced by the digest their Build recorded so the component runs
+// exactly what was built, whatever the tag points to now.
+func (d *Deployment) image(workspace *spot.Workspace, component *spot.ComponentSpec) (string, error) {
+	return d.reference(workspace, component.Image, fmt.Sprintf("component %s", component.Name))
+}
+
+// reference resolves the image of one of the containers, the owner describes
+// the container in the error. Images that are not built run the tag of the
+// spec, if any.
+func (d *Deployment) reference(workspace *spot.Workspace, spec spot.ImageSpec, owner string) (string, error) {
+	if spec.Registry == nil {
+		if spec.Tag != nil && len(*spec.Tag) != 0 {
+			return spec.Name + ":" + *spec.Tag, nil
+		}
+
+		return spec.Name, nil
+	}
+
+	tag := ""
+	if workspace.Spec.Tag != nil {
+		tag = *workspace.Spec.Tag
+	}
+
+	image, ok := workspace.Status.Images[imageKey(spec, tag)]
+	if !ok || len(image.Digest) == 0 {
+		return "", fmt.Errorf("no image was built for %s", owner)
+	}
+
+	return image.Reference(), nil
+}
+
+func (d *Deployment) component(workspace *spot.Workspace, name string) *spot.ComponentSpec {
+	for i := range workspace.Spec.Components {
+		if workspace.Spec.Components[i].Name == name {
+			return &workspace.Spec.Components[i]
+		}
+	}
+
+	return nil
+}
+
+func (d *Deployment) labels(workspace *spot.Workspace, component *spot.ComponentSpec) map[string]string {
+	labels := map[string]string{
+		spot.WorkspaceLabel: workspace.Name,
+		spot.ComponentLabel: component.Name,
+	}
+
+	if len(workspace.Spec.Project.Name) != 0 {
+		labels[spot.ProjectLabel] = workspace.Spec.Project.Name
+	}
+
+	return labels
 }
 
 func (d *Deployment) environmentsForComponent(component *spot.ComponentSpec, workspace *spot.Workspace) ([]core.EnvVar, error) {
+	return d.environments(component.Environments, workspace)
+}
+
+func (d *Deployment) environments(specs []spot.ComponentEnvironmentSpec, workspace *spot.Workspace) ([]core.EnvVar, error) {
 	var environments []core.EnvVar
 
-	for _, env := range component.Environments {
+	for _, env := range specs {
 		envVar := core.EnvVar{}
 
 		if len(env.Alias) != 0 {
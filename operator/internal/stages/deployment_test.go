@@ -0,0 +1,80 @@
+package stages
+
+import (
+	"testing"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+func TestReference(t *testing.T) {
+	tag := func(s string) *string { return &s }
+	workspace := &spot.Workspace{
+		Spec: spot.WorkspaceSpec{Tag: tag("my-branch")},
+		Status: spot.WorkspaceStatus{
+			Images: map[string]spot.BuildImage{
+				"registry.example.com/app:my-branch": {URL: "registry.example.com/app:my-branch", Digest: "sha256:abc"},
+				"registry.example.com/app:v1":        {URL: "registry.example.com/app:v1"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		image spot.ImageSpec
+		want  string
+		err   bool
+	}{
+		{
+			name:  "official image without a tag",
+			image: spot.ImageSpec{Name: "redis"},
+			want:  "redis",
+		},
+		{
+			name:  "official image with a tag",
+			image: spot.ImageSpec{Name: "mysql", Tag: tag("8.0.33")},
+			want:  "mysql:8.0.33",
+		},
+		{
+			name:  "empty tag",
+			image: spot.ImageSpec{Name: "mysql", Tag: tag("")},
+			want:  "mysql",
+		},
+		{
+			name:  "built image pinned to its digest",
+			image: spot.ImageSpec{Name: "app", Registry: &spot.RegistrySpec{URL: "registry.example.com/app"}},
+			want:  "registry.example.com/app:my-branch@sha256:abc",
+		},
+		{
+			name:  "built image without a digest",
+			image: spot.ImageSpec{Name: "app", Registry: &spot.RegistrySpec{URL: "registry.example.com/app"}, Tag: tag("v1")},
+			err:   true,
+		},
+		{
+			name:  "image that wasn't built",
+			image: spot.ImageSpec{Name: "app", Registry: &spot.RegistrySpec{URL: "registry.example.com/other"}},
+			err:   true,
+		},
+	}
+
+	d := &Deployment{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.reference(workspace, tt.image, "component app")
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package stages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"github.com/releasehub-com/spot/operator/internal/repository"
+)
+
+// renderHelm renders the component's chart like `helm template` would, the release is
+// named after the component and installed in the workspace's namespace. The placeholders
+// of the values are replaced before the chart is rendered. The CRDs and the hooks
+// of the chart are left out.
+func (d *Deployment) renderHelm(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]*unstructured.Unstructured, error) {
+	chrt, err := d.chart(ctx, workspace, component)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := action.CheckDependencies(chrt, chrt.Metadata.Dependencies); err != nil {
+		return nil, fmt.Errorf("chart of component %s: %w", component.Name, err)
+	}
+
+	values := make(map[string]interface{})
+	if spec := component.Helm.Values; spec != nil && len(spec.Raw) != 0 {
+		if err := json.Unmarshal(spec.Raw, &values); err != nil {
+			return nil, fmt.Errorf("invalid values for the chart of component %s: %w", component.Name, err)
+		}
+	}
+
+	replacer, err := d.placeholders(workspace, component)
+	if err != nil {
+		return nil, err
+	}
+
+	substitute(values, replacer)
+
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	install.ClientOnly = true
+	install.DryRun = true
+	install.Replace = true
+	install.ReleaseName = component.Name
+	install.Namespace = namespaceFor(workspace)
+
+	release, err := install.RunWithContext(ctx, chrt, values)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't render the chart of component %s: %w", component.Name, err)
+	}
+
+	return decodeObjects(strings.NewReader(release.Manifest))
+}
+
+// chart loads the component's chart from the repository or downloads it from the
+// chart repository. The index of the chart repository is only kept while the
+// chart is looked up.
+func (d *Deployment) chart(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (*chart.Chart, error) {
+	spec := component.Helm
+
+	if len(spec.Path) != 0 {
+		checkout, err := d.checkout(ctx, workspace)
+		if err != nil {
+			return nil, err
+		}
+
+		defer checkout.Close()
+
+		return loader.Load(checkout.Path(spec.Path))
+	}
+
+	if err := d.allowChartURL(spec.Repository); err != nil {
+		return nil, err
+	}
+
+	getters := getter.All(cli.New())
+	chartRepository, err := repo.NewChartRepository(&repo.Entry{Name: component.Name, URL: spec.Repository}, getters)
+	if err != nil {
+		return nil, err
+	}
+
+	chartRepository.CachePath, err = os.MkdirTemp("", "spot-chart-repository-*")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(chartRepository.CachePath)
+
+	indexPath, err := chartRepository.DownloadIndexFile()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch the index of %s: %w", spec.Repository, err)
+	}
+
+	index, err := repo.LoadIndexFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := index.Get(spec.Chart, spec.Version)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find the chart %s %s in %s: %w", spec.Chart, spec.Version, spec.Repository, err)
+	}
+
+	if len(version.URLs) == 0 {
+		return nil, fmt.Errorf("the chart %s %s in %s doesn't have a URL", spec.Chart, version.Version, spec.Repository)
+	}
+
+	chartURL, err := repo.ResolveReferenceURL(spec.Repository, version.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// The index can point to charts hosted anywhere.
+	if err := d.allowChartURL(chartURL); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := getters.ByScheme(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := g.Get(chartURL, getter.WithURL(spec.Repository))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download the chart %s %s: %w", spec.Chart, version.Version, err)
+	}
+
+	return loader.LoadArchive(archive)
+}
+
+// allowChartURL makes sure a chart is only downloaded over https from one of the
+// ChartRepositories so the workspaces can't have the operator send requests
+// to the services of the cluster or the metadata endpoint of its nodes.
+func (d *Deployment) allowChartURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Errorf("charts can only be downloaded over https, got %q", rawURL)
+	}
+
+	if repository.MatchHost(u.Hostname(), d.ChartRepositories) {
+		return nil
+	}
+
+	return fmt.Errorf("charts can't be downloaded from %s, it's not one of the chart repositories of the operator", u.Host)
+}
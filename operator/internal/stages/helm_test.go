@@ -0,0 +1,41 @@
+package stages
+
+import "testing"
+
+func TestAllowChartURL(t *testing.T) {
+	d := &Deployment{ChartRepositories: []string{"charts.bitnami.com", "*.example.com"}}
+
+	tests := []struct {
+		name string
+		url  string
+		err  bool
+	}{
+		{name: "allowed host", url: "https://charts.bitnami.com/bitnami"},
+		{name: "case insensitive", url: "https://Charts.Bitnami.com/bitnami/redis-17.0.0.tgz"},
+		{name: "subdomain", url: "https://charts.example.com/stable"},
+		{name: "nested subdomain", url: "https://eu.charts.example.com/stable"},
+		{name: "wildcard doesn't match the domain itself", url: "https://example.com/stable", err: true},
+		{name: "suffix of another domain", url: "https://evilexample.com/stable", err: true},
+		{name: "other host", url: "https://kubernetes.default.svc/api", err: true},
+		{name: "metadata endpoint", url: "https://169.254.169.254/latest", err: true},
+		{name: "http", url: "http://charts.bitnami.com/bitnami", err: true},
+		{name: "oci", url: "oci://charts.bitnami.com/bitnami", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.allowChartURL(tt.url)
+			if tt.err && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	if err := (&Deployment{}).allowChartURL("https://charts.bitnami.com/bitnami"); err == nil {
+		t.Error("charts were allowed without any chart repository")
+	}
+}
@@ -0,0 +1,109 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// deployJob applies the Job of the component. A Job can't be updated once created, it's
+// named after the component's hash so a new Job runs every time the component changes.
+// The pod isn't restarted when it fails, the failure is reported instead.
+func (d *Deployment) deployJob(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec, template *core.PodTemplateSpec) error {
+	name, err := d.jobName(workspace, component)
+	if err != nil {
+		return err
+	}
+
+	template.Spec.RestartPolicy = core.RestartPolicyNever
+	backoffLimit := int32(0)
+
+	job := &batch.Job{
+		TypeMeta: meta.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: meta.ObjectMeta{
+			Name:      name,
+			Namespace: namespaceFor(workspace),
+			Labels:    d.labels(workspace, component),
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template:     *template,
+		},
+	}
+
+	return d.apply(ctx, job)
+}
+
+// jobResult tells whether the current Job of the component succeeded. When it failed,
+// the failure has the exit code of the container along with the end of its logs.
+func (d *Deployment) jobResult(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) (bool, string, error) {
+	name, err := d.jobName(workspace, component)
+	if err != nil {
+		return false, "", err
+	}
+
+	var job batch.Job
+	if err := d.Client.Get(ctx, client.ObjectKey{Namespace: namespaceFor(workspace), Name: name}, &job); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return false, "", nil
+		}
+
+		return false, "", err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != core.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batch.JobComplete:
+			return true, "", nil
+		case batch.JobFailed:
+			failure, err := d.jobFailure(ctx, &job)
+			return false, failure, err
+		}
+	}
+
+	return false, "", nil
+}
+
+// jobFailure describes why the Job failed from the state of its pod, falling back to
+// the Job's condition. The containers fall back to their logs for their termination
+// message so the end of the logs is part of the description.
+func (d *Deployment) jobFailure(ctx context.Context, job *batch.Job) (string, error) {
+	var pods core.PodList
+	if err := d.Client.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return "", err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == core.PodFailed {
+			return podFailure(&pod), nil
+		}
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batch.JobFailed {
+			return fmt.Sprintf("%s: %s", condition.Reason, condition.Message), nil
+		}
+	}
+
+	return "job failed", nil
+}
+
+func (d *Deployment) jobName(workspace *spot.Workspace, component *spot.ComponentSpec) (string, error) {
+	hash, err := d.componentHash(component, workspace)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%s", component.Name, hash[:10]), nil
+}
@@ -0,0 +1,37 @@
+package stages
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// renderKustomize builds the component's kustomization from the repository. Like
+// `kustomize build`, the files the kustomization loads need to be within its directory.
+func (d *Deployment) renderKustomize(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]*unstructured.Unstructured, error) {
+	checkout, err := d.checkout(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	defer checkout.Close()
+
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(filesys.MakeFsOnDisk(), checkout.Path(component.Kustomize.Path))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build the kustomization of component %s: %w", component.Name, err)
+	}
+
+	content, err := resources.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeObjects(bytes.NewReader(content))
+}
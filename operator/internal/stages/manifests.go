@@ -0,0 +1,66 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// renderManifests reads the objects of every manifest in the component's directory
+// of the repository. The manifests are read in the lexical order of their path.
+func (d *Deployment) renderManifests(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) ([]*unstructured.Unstructured, error) {
+	checkout, err := d.checkout(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	defer checkout.Close()
+
+	var objects []*unstructured.Unstructured
+	err = filepath.WalkDir(checkout.Path(component.Manifests.Path), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		decoded, err := decodeObjects(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+
+		objects = append(objects, decoded...)
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the manifests of component %s: %w", component.Name, err)
+	}
+
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("component %s doesn't have any manifest in %s", component.Name, component.Manifests.Path)
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,147 @@
+package stages
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"github.com/releasehub-com/spot/operator/internal/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Label set on the managed namespace to know which namespace the
+	// owning workspace lives in. The name of the workspace is set with
+	// the spot.WorkspaceLabel.
+	workspaceNamespaceLabel = "spot.release.com/workspace-namespace"
+
+	resourceQuotaName = "spot-quota"
+	limitRangeName    = "spot-limits"
+)
+
+var invalidNamespaceCharacters = regexp.MustCompile("[^a-z0-9-]+")
+
+type Namespace struct {
+	client.Client
+	Config config.NamespaceConfig
+}
+
+// Start makes sure the namespace managed by this workspace exists along with
+// its ResourceQuota and LimitRange. The namespace is recorded in the workspace's status
+// but the status is not persisted, it's up to the next stage to do it.
+func (n *Namespace) Start(ctx context.Context, workspace *spot.Workspace) error {
+	name := managedNamespaceName(workspace)
+
+	var namespace core.Namespace
+	if err := n.Client.Get(ctx, client.ObjectKey{Name: name}, &namespace); err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return err
+		}
+
+		// Namespaces are cluster scoped and can't be owned by a Workspace,
+		// the labels are what ties them together and the teardown takes care
+		// of removing it.
+		namespace = core.Namespace{
+			ObjectMeta: meta.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					spot.WorkspaceLabel:     workspace.Name,
+					workspaceNamespaceLabel: workspace.Namespace,
+				},
+			},
+		}
+
+		if err := n.Client.Create(ctx, &namespace); err != nil {
+			return err
+		}
+	}
+
+	if namespace.Labels[spot.WorkspaceLabel] != workspace.Name || namespace.Labels[workspaceNamespaceLabel] != workspace.Namespace {
+		return fmt.Errorf("namespace %s already exists and is not managed by this workspace", name)
+	}
+
+	if n.Config.ResourceQuota != nil {
+		quota := &core.ResourceQuota{
+			ObjectMeta: meta.ObjectMeta{Name: resourceQuotaName, Namespace: name},
+			Spec:       *n.Config.ResourceQuota,
+		}
+
+		if err := createOrUpdate(ctx, n.Client, quota, func(existing client.Object) {
+			existing.(*core.ResourceQuota).Spec = quota.Spec
+		}); err != nil {
+			return err
+		}
+	}
+
+	if n.Config.LimitRange != nil {
+		limits := &core.LimitRange{
+			ObjectMeta: meta.ObjectMeta{Name: limitRangeName, Namespace: name},
+			Spec:       *n.Config.LimitRange,
+		}
+
+		if err := createOrUpdate(ctx, n.Client, limits, func(existing client.Object) {
+			existing.(*core.LimitRange).Spec = limits.Spec
+		}); err != nil {
+			return err
+		}
+	}
+
+	workspace.Status.Namespace = name
+
+	return nil
+}
+
+// createOrUpdate creates the object if it doesn't exist yet. Otherwise, the existing object
+// is mutated to match the desired one. Only what the operator manages needs to be copied
+// over so the fields set by the cluster are preserved.
+func createOrUpdate(ctx context.Context, c client.Client, object client.Object, mutate func(client.Object)) error {
+	existing := object.DeepCopyObject().(client.Object)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(object), existing); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return c.Create(ctx, object)
+		}
+
+		return err
+	}
+
+	mutate(existing)
+
+	return c.Update(ctx, existing)
+}
+
+// managedNamespaceName generates a DNS compatible name from the namespace and
+// the name of the workspace, they are what identifies it in the cluster. The name is
+// always suffixed with a hash of both so workspaces that only differ by characters
+// that are replaced, or by the part that's truncated when the name is too long,
+// don't share a namespace.
+func managedNamespaceName(workspace *spot.Workspace) string {
+	sum := sha1.Sum([]byte(workspace.Namespace + "/" + workspace.Name))
+	suffix := hex.EncodeToString(sum[:])[:8]
+
+	full := strings.Join([]string{"spot", workspace.Namespace, workspace.Name}, "-")
+	name := strings.Trim(invalidNamespaceCharacters.ReplaceAllString(strings.ToLower(full), "-"), "-")
+
+	if max := validation.DNS1123LabelMaxLength - len(suffix) - 1; len(name) > max {
+		name = strings.TrimRight(name[:max], "-")
+	}
+
+	return name + "-" + suffix
+}
+
+// namespaceFor returns the namespace where the components of the workspace live.
+func namespaceFor(workspace *spot.Workspace) string {
+	if len(workspace.Status.Namespace) != 0 {
+		return workspace.Status.Namespace
+	}
+
+	return workspace.Namespace
+}
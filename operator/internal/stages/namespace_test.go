@@ -0,0 +1,94 @@
+package stages
+
+import (
+	"strings"
+	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+func TestManagedNamespaceName(t *testing.T) {
+	workspace := func(namespace, name string) *spot.Workspace {
+		return &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	tests := []struct {
+		name      string
+		workspace *spot.Workspace
+		prefix    string
+	}{
+		{
+			name:      "namespace and name",
+			workspace: workspace("previews", "shop-main"),
+			prefix:    "spot-previews-shop-main-",
+		},
+		{
+			name:      "invalid characters",
+			workspace: workspace("previews", "Shop.Main"),
+			prefix:    "spot-previews-shop-main-",
+		},
+		{
+			name:      "truncated",
+			workspace: workspace("previews", strings.Repeat("feature-", 10)),
+			prefix:    "spot-previews-feature-feature-feature-feature-feature-",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := managedNamespaceName(tt.workspace)
+			if errs := validation.IsDNS1123Label(got); len(errs) != 0 {
+				t.Fatalf("%q isn't a valid namespace: %v", got, errs)
+			}
+
+			if !strings.HasPrefix(got, tt.prefix) || len(got) > len(tt.prefix)+9 {
+				t.Errorf("got %q, want %q followed by a hash", got, tt.prefix)
+			}
+
+			if got != managedNamespaceName(tt.workspace) {
+				t.Errorf("the name isn't stable")
+			}
+		})
+	}
+}
+
+func TestManagedNamespaceNameCollisions(t *testing.T) {
+	long := strings.Repeat("feature-", 10)
+
+	tests := []struct {
+		name string
+		a, b *spot.Workspace
+	}{
+		{
+			name: "same name in different namespaces",
+			a:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team-a", Name: "shop-main"}},
+			b:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team-b", Name: "shop-main"}},
+		},
+		{
+			name: "same name once joined",
+			a:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team-a", Name: "shop"}},
+			b:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "a-shop"}},
+		},
+		{
+			name: "same name once sanitized",
+			a:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "shop.main"}},
+			b:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "shop-main"}},
+		},
+		{
+			name: "same name once truncated",
+			a:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: long + "a"}},
+			b:    &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: long + "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := managedNamespaceName(tt.a), managedNamespaceName(tt.b); a == b {
+				t.Errorf("both workspaces got the namespace %q", a)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"github.com/releasehub-com/spot/operator/internal/routing"
+)
+
+var invalidHostCharacters = regexp.MustCompile("[^a-z0-9-]+")
+
+// deployRoutes applies a route for every port of the component that sets `ingress`
+// and records it in the workspace's status. The routes of ports that are not
+// exposed anymore are pruned by deploy.
+func (d *Deployment) deployRoutes(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error {
+	backend, err := routing.New(d.Ingress)
+	if err != nil {
+		return err
+	}
+
+	d.removeRoutes(workspace, component.Name)
+
+	for _, service := range component.AllServices() {
+		if len(service.Ingress) == 0 {
+			continue
+		}
+
+		host, err := d.host(workspace, component, &service)
+		if err != nil {
+			return err
+		}
+
+		route := routing.Route{
+			Name:      routeName(component, &service),
+			Namespace: namespaceFor(workspace),
+			Labels:    d.labels(workspace, component),
+			Host:      host,
+			Path:      ingressPath(&service),
+			Target:    routing.Target{Service: component.Name, Port: int32(service.Port)},
+		}
+
+		if err := d.apply(ctx, backend.Object(route)); err != nil {
+			return err
+		}
+
+		scheme := "http"
+		if d.Ingress.TLS != nil {
+			scheme = "https"
+		}
+
+		d.setRoute(workspace, spot.RouteStatus{
+			Component: component.Name,
+			Host:      host,
+			Path:      route.Path,
+			URL:       fmt.Sprintf("%s://%s%s", scheme, host, route.Path),
+			Service:   component.Name,
+			Port:      int32(service.Port),
+		})
+	}
+
+	return nil
+}
+
+// host renders the host template for the service. The values are sanitized so
+// they are valid DNS labels, ie. a branch named `feature/login` becomes `feature-login`.
+func (d *Deployment) host(workspace *spot.Workspace, component *spot.ComponentSpec, service *spot.ServiceSpec) (string, error) {
+	label := func(value string) string {
+		return strings.Trim(invalidHostCharacters.ReplaceAllString(strings.ToLower(value), "-"), "-")
+	}
+
+	replacer := strings.NewReplacer(
+		"{{ingress}}", label(service.Ingress),
+		"{{component}}", label(component.Name),
+		"{{workspace}}", label(workspace.Name),
+		"{{branch}}", label(workspace.Spec.Branch.Name),
+		"{{project}}", label(workspace.Spec.Project.Name),
+		"{{domain}}", strings.ToLower(d.Ingress.Domain),
+	)
+
+	host := replacer.Replace(d.Ingress.Host)
+	if errs := validation.IsDNS1123Subdomain(host); len(errs) != 0 {
+		return "", fmt.Errorf("invalid host %q for the ingress of component %s: %s", host, component.Name, strings.Join(errs, ", "))
+	}
+
+	return host, nil
+}
+
+func routeName(component *spot.ComponentSpec, service *spot.ServiceSpec) string {
+	return fmt.Sprintf("%s-%s", component.Name, service.PortName())
+}
+
+func ingressPath(service *spot.ServiceSpec) string {
+	if len(service.Path) == 0 {
+		return "/"
+	}
+
+	return service.Path
+}
@@ -0,0 +1,338 @@
+package stages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	apps "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	core "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gateway "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/releasehub-com/spot/operator/internal/routing"
+)
+
+const (
+	// Service created in the workspace's namespace while it sleeps. The Ingresses
+	// of the workspace are sent to the receiver's proxy through it so a request
+	// can wake the workspace up.
+	wakeServiceName = "spot-wake"
+
+	receiverNamespace   = "spot-system"
+	receiverServiceName = "receiver"
+	receiverProxyHost   = receiverServiceName + "." + receiverNamespace + ".svc.cluster.local"
+	receiverProxyPort   = 3334
+)
+
+// Annotation recording the replicas of a workload before the workspace went
+// to sleep. The workload is scaled back to them when the workspace wakes up.
+const sleepReplicasAnnotation = "spot.release.com/replicas-before-sleep"
+
+type Sleep struct {
+	client.Client
+}
+
+// Start scales every workload of the workspace down to zero, the ones rendered from the
+// manifests of the components included. Only the workloads are scaled down, the services
+// are kept so the workspace comes back exactly as it was when it wakes up. The routes
+// are sent to the receiver's proxy in the meantime.
+func (s *Sleep) Start(ctx context.Context, workspace *spot.Workspace) error {
+	workloads, err := s.workloads(ctx, workspace)
+	if err != nil {
+		return err
+	}
+
+	for _, workload := range workloads {
+		if err := s.scaleDown(ctx, workload); err != nil {
+			return err
+		}
+	}
+
+	if err := s.routeToProxy(ctx, workspace); err != nil {
+		return err
+	}
+
+	workspace.Status.WokenAt = nil
+	workspace.SetStage(spot.WorkspaceStageSleeping, fmt.Sprintf("%d components scaled down", len(workspace.Spec.Components)))
+
+	return s.Client.SubResource("status").Update(ctx, workspace)
+}
+
+// Wake scales the workloads back to the replicas they had before the workspace went
+// to sleep, along with their routes. Nothing is deployed, if the spec changed while the
+// workspace was sleeping, the changes are rolled out once the workspace is running again.
+func (s *Sleep) Wake(ctx context.Context, workspace *spot.Workspace) error {
+	if err := s.restoreWorkloads(ctx, workspace); err != nil {
+		return err
+	}
+
+	return s.Resume(ctx, workspace)
+}
+
+// WakeOnRequest restores the workloads of the components but keeps the routes on
+// the receiver's proxy so it can tell when the workspace is idle again.
+func (s *Sleep) WakeOnRequest(ctx context.Context, workspace *spot.Workspace) error {
+	if err := s.restoreWorkloads(ctx, workspace); err != nil {
+		return err
+	}
+
+	now := meta.Now()
+	workspace.Status.WokenAt = &now
+	workspace.SetStage(spot.WorkspaceStageRunning, "Woken up by a request")
+
+	return s.Client.SubResource("status").Update(ctx, workspace)
+}
+
+// Resume sends the routes back to the components once the sleep
+// schedule doesn't have the workspace asleep anymore.
+func (s *Sleep) Resume(ctx context.Context, workspace *spot.Workspace) error {
+	if err := s.restoreRoutes(ctx, workspace); err != nil {
+		return err
+	}
+
+	workspace.Status.WokenAt = nil
+	workspace.SetStage(spot.WorkspaceStageRunning, "")
+
+	return s.Client.SubResource("status").Update(ctx, workspace)
+}
+
+// workloads returns the Deployments and StatefulSets of the workspace, whether they
+// run the image of a component or were rendered from its manifests. Jobs run to
+// completion, they are left untouched.
+func (s *Sleep) workloads(ctx context.Context, workspace *spot.Workspace) ([]client.Object, error) {
+	opts := []client.ListOption{client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name}}
+
+	var deployments apps.DeploymentList
+	if err := s.Client.List(ctx, &deployments, opts...); err != nil {
+		return nil, err
+	}
+
+	var statefulSets apps.StatefulSetList
+	if err := s.Client.List(ctx, &statefulSets, opts...); err != nil {
+		return nil, err
+	}
+
+	var workloads []client.Object
+	for i := range deployments.Items {
+		workloads = append(workloads, &deployments.Items[i])
+	}
+
+	for i := range statefulSets.Items {
+		workloads = append(workloads, &statefulSets.Items[i])
+	}
+
+	return workloads, nil
+}
+
+// scaleDown records the replicas of the workload and scales it to zero. The replicas
+// are only recorded once so a workload that is already scaled down keeps them.
+// Autoscalers don't scale workloads that are at zero.
+func (s *Sleep) scaleDown(ctx context.Context, workload client.Object) error {
+	if _, ok := workload.GetAnnotations()[sleepReplicasAnnotation]; !ok {
+		var replicas *int32
+		switch w := workload.(type) {
+		case *apps.Deployment:
+			replicas = w.Spec.Replicas
+		case *apps.StatefulSet:
+			replicas = w.Spec.Replicas
+		}
+
+		recorded := "1"
+		if replicas != nil {
+			recorded = strconv.Itoa(int(*replicas))
+		}
+
+		if err := s.annotate(ctx, workload, &recorded); err != nil {
+			return err
+		}
+	}
+
+	return s.scale(ctx, workload, 0)
+}
+
+// restoreWorkloads scales the workloads back to the replicas recorded when the
+// workspace went to sleep. The components were all ready before going to sleep
+// so they are not held on their dependencies.
+func (s *Sleep) restoreWorkloads(ctx context.Context, workspace *spot.Workspace) error {
+	workloads, err := s.workloads(ctx, workspace)
+	if err != nil {
+		return err
+	}
+
+	for _, workload := range workloads {
+		recorded, ok := workload.GetAnnotations()[sleepReplicasAnnotation]
+		if !ok {
+			continue
+		}
+
+		replicas, err := strconv.ParseInt(recorded, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid replicas recorded on %s: %w", workload.GetName(), err)
+		}
+
+		if err := s.scale(ctx, workload, int32(replicas)); err != nil {
+			return err
+		}
+
+		if err := s.annotate(ctx, workload, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scale sets the replicas of the workload through its scale subresource, the same way
+// an autoscaler does. The rest of the workload stays owned by whoever applied it.
+func (s *Sleep) scale(ctx context.Context, workload client.Object, replicas int32) error {
+	patch := client.RawPatch(types.MergePatchType, []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)))
+	return s.Client.SubResource("scale").Patch(ctx, workload, patch, client.WithSubResourceBody(&autoscalingv1.Scale{}))
+}
+
+// annotate sets the replicas recorded on the workload, they are removed when nil.
+func (s *Sleep) annotate(ctx context.Context, workload client.Object, replicas *string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{sleepReplicasAnnotation: replicas},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.Client.Patch(ctx, workload, client.RawPatch(types.MergePatchType, data))
+}
+
+// routeToProxy sends the routes of the workspace to the receiver's proxy. The Ingresses
+// can only send the traffic to the services of their namespace, they go through an
+// ExternalName service. The implementations of the Gateway API refuse those, the
+// HTTPRoutes reference the receiver's service directly and are granted to do so by
+// a ReferenceGrant in the receiver's namespace.
+func (s *Sleep) routeToProxy(ctx context.Context, workspace *spot.Workspace) error {
+	service := core.Service{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      wakeServiceName,
+			Namespace: namespaceFor(workspace),
+			Labels:    map[string]string{spot.WorkspaceLabel: workspace.Name},
+		},
+		Spec: core.ServiceSpec{
+			Type:         core.ServiceTypeExternalName,
+			ExternalName: receiverProxyHost,
+		},
+	}
+
+	if err := s.Client.Create(ctx, &service); err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	receiver := gateway.ObjectName(receiverServiceName)
+	grant := gateway.ReferenceGrant{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      wakeGrantName(workspace),
+			Namespace: receiverNamespace,
+			Labels: map[string]string{
+				spot.WorkspaceLabel:     workspace.Name,
+				workspaceNamespaceLabel: workspace.Namespace,
+			},
+		},
+		Spec: gateway.ReferenceGrantSpec{
+			From: []gateway.ReferenceGrantFrom{{
+				Group:     gateway.GroupName,
+				Kind:      "HTTPRoute",
+				Namespace: gateway.Namespace(namespaceFor(workspace)),
+			}},
+			To: []gateway.ReferenceGrantTo{{Kind: "Service", Name: &receiver}},
+		},
+	}
+
+	// The Gateway API might not be installed in the cluster.
+	if err := s.Client.Create(ctx, &grant); err != nil && !k8sErrors.IsAlreadyExists(err) && !apimeta.IsNoMatchError(err) {
+		return err
+	}
+
+	return s.updateBackends(ctx, workspace, func(backend routing.Backend, host, path string) *routing.Target {
+		if _, ok := backend.(*routing.HTTPRoute); ok {
+			return &routing.Target{Service: receiverServiceName, Namespace: receiverNamespace, Port: receiverProxyPort}
+		}
+
+		return &routing.Target{Service: wakeServiceName, Port: receiverProxyPort}
+	})
+}
+
+func (s *Sleep) restoreRoutes(ctx context.Context, workspace *spot.Workspace) error {
+	err := s.updateBackends(ctx, workspace, func(backend routing.Backend, host, path string) *routing.Target {
+		for _, route := range workspace.Status.Routes {
+			if route.Host == host && route.Path == path {
+				return &routing.Target{Service: route.Service, Port: route.Port}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	service := core.Service{ObjectMeta: meta.ObjectMeta{Name: wakeServiceName, Namespace: namespaceFor(workspace)}}
+	if err := s.Client.Delete(ctx, &service); err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+
+	grant := gateway.ReferenceGrant{ObjectMeta: meta.ObjectMeta{Name: wakeGrantName(workspace), Namespace: receiverNamespace}}
+	if err := s.Client.Delete(ctx, &grant); err != nil && !k8sErrors.IsNotFound(err) && !apimeta.IsNoMatchError(err) {
+		return err
+	}
+
+	return nil
+}
+
+// wakeGrantName returns the name of the ReferenceGrant letting the HTTPRoutes
+// of the workspace reference the receiver's service while it sleeps.
+func wakeGrantName(workspace *spot.Workspace) string {
+	return wakeServiceName + "-" + namespaceFor(workspace)
+}
+
+// updateBackends replaces the target of every path of the workspace's routes with
+// the one returned for the path's host and the route's backend. Paths without a target
+// are left untouched. The routes of every backend are updated, whichever is configured.
+func (s *Sleep) updateBackends(ctx context.Context, workspace *spot.Workspace, target func(backend routing.Backend, host, path string) *routing.Target) error {
+	for _, backend := range routing.All(spot.IngressSpec{}) {
+		list := backend.List()
+		if err := s.Client.List(ctx, list, client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name}); err != nil {
+			// The Gateway API might not be installed in the cluster.
+			if apimeta.IsNoMatchError(err) {
+				continue
+			}
+
+			return err
+		}
+
+		items, err := apimeta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			object, ok := item.(client.Object)
+			if !ok || !backend.Retarget(object, func(host, path string) *routing.Target { return target(backend, host, path) }) {
+				continue
+			}
+
+			if err := s.Client.Update(ctx, object); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
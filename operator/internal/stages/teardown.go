@@ -0,0 +1,270 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gateway "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/releasehub-com/spot/operator/internal/routing"
+)
+
+// Namespace where the builder pods are scheduled.
+const builderNamespace = "spot-system"
+
+type Teardown struct {
+	client.Client
+}
+
+// Start removes everything the operator created for the workspace. The order
+// is deterministic: in-flight builds are cancelled first so they can't spawn new
+// builder pods, then the builder pods, then the routes to the components along
+// with the grant to the receiver of sleeping workspaces, the objects rendered
+// from manifests, the components themselves, their volumes and finally the
+// managed namespace.
+//
+// The deletions don't wait on the objects to be gone, Start is called again
+// until a pass doesn't find anything left. Every object removed is recorded in
+// the workspace's status and the workspace is only moved to the Deleted stage
+// once the last of them, the managed namespace, is gone.
+func (t *Teardown) Start(ctx context.Context, workspace *spot.Workspace) error {
+	logger := log.FromContext(ctx)
+
+	builds, err := t.cancelBuilds(ctx, workspace)
+	if err != nil {
+		return err
+	}
+
+	steps := []func(context.Context, *spot.Workspace) ([]spot.ResourceReference, error){
+		func(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+			return t.deleteBuilderPods(ctx, append(removedBuilds(workspace), builds...))
+		},
+		t.deleteRoutes,
+		t.deleteGrants,
+		t.deleteRenderedObjects,
+		t.deleteServices,
+		t.deleteAutoscalers,
+		t.deleteDeployments,
+		t.deleteJobs,
+		t.deleteVolumeClaims,
+		t.deleteNamespace,
+	}
+
+	found := builds
+	for _, step := range steps {
+		references, err := step(ctx, workspace)
+		if err != nil {
+			return err
+		}
+
+		found = append(found, references...)
+	}
+
+	recorded := make(map[spot.ResourceReference]bool)
+	for _, reference := range workspace.Status.Removed {
+		recorded[reference] = true
+	}
+
+	for _, reference := range found {
+		if recorded[reference] {
+			continue
+		}
+
+		logger.Info("removed", "object", reference.String())
+		workspace.Status.Removed = append(workspace.Status.Removed, reference)
+		recorded[reference] = true
+	}
+
+	if len(found) != 0 {
+		workspace.SetStage(spot.WorkspaceStageTerminating, fmt.Sprintf("Waiting on %d objects to be removed", len(found)))
+		return t.Client.Status().Update(ctx, workspace)
+	}
+
+	workspace.SetStage(spot.WorkspaceStageDeleted, fmt.Sprintf("Removed %d objects", len(workspace.Status.Removed)))
+	return t.Client.Status().Update(ctx, workspace)
+}
+
+// removedBuilds returns the builds removed by the previous passes, their
+// builder pods can outlive them.
+func removedBuilds(workspace *spot.Workspace) []spot.ResourceReference {
+	var builds []spot.ResourceReference
+	for _, reference := range workspace.Status.Removed {
+		if reference.Kind == "Build" {
+			builds = append(builds, reference)
+		}
+	}
+
+	return builds
+}
+
+func (t *Teardown) cancelBuilds(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	return t.deleteAll(ctx, &spot.BuildList{}, "Build", client.InNamespace(workspace.Namespace), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name})
+}
+
+func (t *Teardown) deleteBuilderPods(ctx context.Context, builds []spot.ResourceReference) ([]spot.ResourceReference, error) {
+	if len(builds) == 0 {
+		return nil, nil
+	}
+
+	var names []string
+	for _, build := range builds {
+		names = append(names, build.Name)
+	}
+
+	requirement, err := labels.NewRequirement(spot.BuildLabel, selection.In, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.deleteAll(ctx, &core.PodList{}, "Pod", client.InNamespace(builderNamespace), client.MatchingLabelsSelector{Selector: labels.NewSelector().Add(*requirement)})
+}
+
+// deleteRoutes removes the routes of every backend. The ones of the Gateway
+// API are skipped when it's not installed in the cluster.
+func (t *Teardown) deleteRoutes(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	var references []spot.ResourceReference
+	for _, backend := range routing.All(spot.IngressSpec{}) {
+		deleted, err := t.deleteAll(ctx, backend.List(), backend.Kind(), client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name})
+		if err != nil {
+			if apimeta.IsNoMatchError(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		references = append(references, deleted...)
+	}
+
+	return references, nil
+}
+
+// deleteGrants removes the ReferenceGrant letting the HTTPRoutes of a sleeping
+// workspace reference the receiver's service. It's skipped when the Gateway API
+// is not installed in the cluster.
+func (t *Teardown) deleteGrants(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	references, err := t.deleteAll(ctx, &gateway.ReferenceGrantList{}, "ReferenceGrant", client.InNamespace(receiverNamespace), client.MatchingLabels{
+		spot.WorkspaceLabel:     workspace.Name,
+		workspaceNamespaceLabel: workspace.Namespace,
+	})
+
+	if apimeta.IsNoMatchError(err) {
+		return nil, nil
+	}
+
+	return references, err
+}
+
+// deleteRenderedObjects removes the objects rendered from the manifests of the
+// components. They are only known from the status of their component.
+func (t *Teardown) deleteRenderedObjects(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	return deleteObjects(ctx, t.Client, componentObjects(workspace))
+}
+
+func (t *Teardown) deleteServices(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	return t.deleteAll(ctx, &core.ServiceList{}, "Service", client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name})
+}
+
+// deleteAutoscalers removes the autoscalers before their Deployments
+// so they don't scale the Deployments while they are deleted.
+func (t *Teardown) deleteAutoscalers(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	return t.deleteAll(ctx, &autoscaling.HorizontalPodAutoscalerList{}, "HorizontalPodAutoscaler", client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name})
+}
+
+func (t *Teardown) deleteDeployments(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	return t.deleteAll(ctx, &apps.DeploymentList{}, "Deployment", client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name})
+}
+
+func (t *Teardown) deleteJobs(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	return t.deleteAll(ctx, &batch.JobList{}, "Job", client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name})
+}
+
+// deleteVolumeClaims removes the claims of the components' volumes. The volumes
+// that are retained are marked as such first so they outlive their claim.
+func (t *Teardown) deleteVolumeClaims(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	var claims core.PersistentVolumeClaimList
+	if err := t.Client.List(ctx, &claims, client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name}); err != nil {
+		return nil, err
+	}
+
+	for _, claim := range claims.Items {
+		if err := retainVolume(ctx, t.Client, &claim); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.deleteAll(ctx, &core.PersistentVolumeClaimList{}, "PersistentVolumeClaim", client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name})
+}
+
+// deleteNamespace removes the namespace managed by the workspace. It's
+// removed last as deleting it would remove everything it contains in
+// no particular order.
+func (t *Teardown) deleteNamespace(ctx context.Context, workspace *spot.Workspace) ([]spot.ResourceReference, error) {
+	if len(workspace.Status.Namespace) == 0 || workspace.Status.Namespace == workspace.Namespace {
+		return nil, nil
+	}
+
+	return t.deleteAll(ctx, &core.NamespaceList{}, "Namespace", client.MatchingLabels{
+		spot.WorkspaceLabel:     workspace.Name,
+		workspaceNamespaceLabel: workspace.Namespace,
+	})
+}
+
+// deleteAll lists the objects matching the options and deletes them sorted by name
+// so the teardown always happens in the same order. Every object found is reported,
+// the ones that are already being deleted are only waited on.
+func (t *Teardown) deleteAll(ctx context.Context, list client.ObjectList, kind string, opts ...client.ListOption) ([]spot.ResourceReference, error) {
+	if err := t.Client.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []client.Object
+	for _, item := range items {
+		if object, ok := item.(client.Object); ok {
+			objects = append(objects, object)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].GetName() < objects[j].GetName()
+	})
+
+	var references []spot.ResourceReference
+	for _, object := range objects {
+		if object.GetDeletionTimestamp().IsZero() {
+			if err := t.Client.Delete(ctx, object, client.PropagationPolicy("Background")); err != nil {
+				if k8sErrors.IsNotFound(err) {
+					continue
+				}
+
+				return references, err
+			}
+		}
+
+		references = append(references, spot.ResourceReference{
+			Kind:      kind,
+			Namespace: object.GetNamespace(),
+			Name:      object.GetName(),
+		})
+	}
+
+	return references, nil
+}
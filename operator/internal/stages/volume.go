@@ -0,0 +1,136 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Set on the claims so the reclaim policy of their volume is known even
+// after the volume was removed from the spec.
+const reclaimPolicyAnnotation = "spot.release.com/reclaim-policy"
+
+// deployVolumes applies a PersistentVolumeClaim for every volume of the component. The
+// claims are left alone when the component is rolled out so the data survives.
+func (d *Deployment) deployVolumes(ctx context.Context, workspace *spot.Workspace, component *spot.ComponentSpec) error {
+	for _, volume := range component.Volumes {
+		claim := &core.PersistentVolumeClaim{
+			TypeMeta: meta.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+			ObjectMeta: meta.ObjectMeta{
+				Name:      claimName(component, &volume),
+				Namespace: namespaceFor(workspace),
+				Labels:    d.labels(workspace, component),
+				Annotations: map[string]string{
+					reclaimPolicyAnnotation: string(volume.GetReclaimPolicy()),
+				},
+			},
+			Spec: core.PersistentVolumeClaimSpec{
+				AccessModes:      []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
+				StorageClassName: volume.StorageClass,
+				Resources: core.ResourceRequirements{
+					Requests: core.ResourceList{core.ResourceStorage: volume.Size},
+				},
+			},
+		}
+
+		if err := d.apply(ctx, claim); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// volumes returns the volumes of the component's pod and where
+// they are mounted in its container.
+func (d *Deployment) volumes(component *spot.ComponentSpec) ([]core.Volume, []core.VolumeMount) {
+	var volumes []core.Volume
+	var mounts []core.VolumeMount
+
+	for _, volume := range component.Volumes {
+		volumes = append(volumes, core.Volume{
+			Name: volume.Name,
+			VolumeSource: core.VolumeSource{
+				PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: claimName(component, &volume)},
+			},
+		})
+
+		mounts = append(mounts, core.VolumeMount{Name: volume.Name, MountPath: volume.MountPath})
+	}
+
+	return volumes, mounts
+}
+
+// refreshVolumes records the volumes of the components in the
+// workspace's status along with the state of their claim.
+func (d *Deployment) refreshVolumes(ctx context.Context, workspace *spot.Workspace) error {
+	var claims core.PersistentVolumeClaimList
+	if err := d.Client.List(ctx, &claims, client.InNamespace(namespaceFor(workspace)), client.MatchingLabels{spot.WorkspaceLabel: workspace.Name}); err != nil {
+		return err
+	}
+
+	existing := make(map[string]*core.PersistentVolumeClaim)
+	for i := range claims.Items {
+		existing[claims.Items[i].Name] = &claims.Items[i]
+	}
+
+	var volumes []spot.VolumeStatus
+	for _, component := range workspace.Spec.Components {
+		for _, volume := range component.Volumes {
+			status := spot.VolumeStatus{
+				Component:     component.Name,
+				Name:          volume.Name,
+				Claim:         claimName(&component, &volume),
+				ReclaimPolicy: volume.GetReclaimPolicy(),
+			}
+
+			if claim, ok := existing[status.Claim]; ok {
+				status.Phase = claim.Status.Phase
+				status.VolumeName = claim.Spec.VolumeName
+
+				if capacity, ok := claim.Status.Capacity[core.ResourceStorage]; ok {
+					status.Capacity = &capacity
+				}
+			}
+
+			volumes = append(volumes, status)
+		}
+	}
+
+	workspace.Status.Volumes = volumes
+	return nil
+}
+
+// retainVolume makes sure the PersistentVolume bound to the claim outlives it when the
+// volume is to be retained. Claims that are not bound yet don't have any data to keep.
+func retainVolume(ctx context.Context, c client.Client, claim *core.PersistentVolumeClaim) error {
+	if claim.Annotations[reclaimPolicyAnnotation] != string(spot.VolumeReclaimPolicyRetain) || len(claim.Spec.VolumeName) == 0 {
+		return nil
+	}
+
+	var volume core.PersistentVolume
+	if err := c.Get(ctx, client.ObjectKey{Name: claim.Spec.VolumeName}, &volume); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if volume.Spec.PersistentVolumeReclaimPolicy == core.PersistentVolumeReclaimRetain {
+		return nil
+	}
+
+	volume.Spec.PersistentVolumeReclaimPolicy = core.PersistentVolumeReclaimRetain
+	return c.Update(ctx, &volume)
+}
+
+func claimName(component *spot.ComponentSpec, volume *spot.VolumeSpec) string {
+	return fmt.Sprintf("%s-%s", component.Name, volume.Name)
+}
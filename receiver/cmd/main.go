@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/releasehub-com/spot/receiver/internal/controllers"
 
@@ -30,7 +31,20 @@ func main() {
 
 	spot.AddToScheme(scheme.Scheme)
 
+	// The receiver stops as soon as one of the servers does.
+	errs := make(chan error, 2)
+
+	fmt.Printf("Starting the proxy\n")
+	go func() {
+		errs <- http.ListenAndServe(":3334", &controllers.Proxy{Client: client})
+	}()
+
 	fmt.Printf("Starting the server\n")
 	http.Handle("/", &controllers.Workspace{Client: client})
-	http.ListenAndServe(":3333", nil)
+	go func() {
+		errs <- http.ListenAndServe(":3333", nil)
+	}()
+
+	fmt.Println("Stopping the receiver: ", <-errs)
+	os.Exit(1)
 }
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+const (
+	// How long a request is held while its workspace wakes up.
+	wakeTimeout = 2 * time.Minute
+
+	// How often the routes are listed again from the workspaces.
+	routesRefreshInterval = 30 * time.Second
+
+	// Hosts that are not known are looked up again at most once per interval
+	// so requests with a stray host don't list the workspaces every time.
+	unknownHostRefreshInterval = 5 * time.Second
+
+	// The last request is recorded at most once per interval
+	// to avoid updating the workspace on every request.
+	lastRequestInterval = time.Minute
+)
+
+// Proxy is the backend of the routes of the sleeping workspaces. It
+// holds the requests while the workspace wakes up and forwards them
+// once the component accepts connections.
+type Proxy struct {
+	Client rest.Interface
+
+	// Held while the routes are listed so only one list runs at a time,
+	// the requests for known hosts are served in the meantime.
+	refreshing sync.Mutex
+
+	mutex        sync.Mutex
+	targets      map[string][]target
+	refreshedAt  time.Time
+	lastRequests map[types.NamespacedName]time.Time
+}
+
+type target struct {
+	workspace types.NamespacedName
+	path      string
+	address   string
+}
+
+func (p *Proxy) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	host := request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	target, err := p.lookup(request.Context(), host, request.URL.Path)
+	if err != nil {
+		fmt.Println("Error trying to find the workspace for ", host, ": ", err)
+		http.Error(response, "Couldn't find the workspace", http.StatusBadGateway)
+		return
+	}
+
+	if target == nil {
+		http.NotFound(response, request)
+		return
+	}
+
+	if !reachable(target.address) {
+		if err := p.wake(request.Context(), target); err != nil {
+			fmt.Println("Error trying to wake up ", target.workspace, ": ", err)
+			http.Error(response, "The workspace is waking up, try again in a moment", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	p.recordRequest(request.Context(), target.workspace)
+
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: target.address})
+	proxy.ServeHTTP(response, request)
+}
+
+// wake asks the operator to wake up the workspace and waits until
+// the component accepts connections.
+func (p *Proxy) wake(ctx context.Context, target *target) error {
+	if err := annotate(ctx, p.Client, target.workspace.Namespace, target.workspace.Name, spot.WakeRequestedAnnotation, time.Now()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wakeTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if reachable(target.address) {
+				return nil
+			}
+		}
+	}
+}
+
+// recordRequest lets the operator know the workspace is still in use.
+func (p *Proxy) recordRequest(ctx context.Context, workspace types.NamespacedName) {
+	now := time.Now()
+
+	p.mutex.Lock()
+	if p.lastRequests == nil {
+		p.lastRequests = make(map[types.NamespacedName]time.Time)
+	}
+
+	if now.Sub(p.lastRequests[workspace]) < lastRequestInterval {
+		p.mutex.Unlock()
+		return
+	}
+
+	p.lastRequests[workspace] = now
+	p.mutex.Unlock()
+
+	if err := annotate(ctx, p.Client, workspace.Namespace, workspace.Name, spot.LastRequestAnnotation, now); err != nil {
+		fmt.Println("Error trying to record the last request of ", workspace, ": ", err)
+	}
+}
+
+// lookup returns the target with the longest path prefix matching the request. The routes are
+// listed again from the workspaces when they are stale or when the host is not known yet.
+func (p *Proxy) lookup(ctx context.Context, host, path string) (*target, error) {
+	if target, ok := p.cached(host, path); ok {
+		return target, nil
+	}
+
+	p.refreshing.Lock()
+	defer p.refreshing.Unlock()
+
+	// The routes might have been listed while waiting on another request.
+	if target, ok := p.cached(host, path); ok {
+		return target, nil
+	}
+
+	targets, err := p.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.targets = targets
+	p.refreshedAt = time.Now()
+
+	return p.match(host, path), nil
+}
+
+// cached returns the target from the routes that were last listed as long as they are
+// fresh. Unknown hosts are answered from them too right after they were listed.
+func (p *Proxy) cached(host, path string) (*target, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	age := time.Since(p.refreshedAt)
+	if _, ok := p.targets[host]; !ok && age >= unknownHostRefreshInterval {
+		return nil, false
+	}
+
+	if age >= routesRefreshInterval {
+		return nil, false
+	}
+
+	return p.match(host, path), true
+}
+
+// list returns the targets of the routes of the workspaces of every namespace by host.
+func (p *Proxy) list(ctx context.Context) (map[string][]target, error) {
+	var workspaces spot.WorkspaceList
+	if err := p.Client.Get().Resource("workspaces").Do(ctx).Into(&workspaces); err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string][]target)
+	for _, workspace := range workspaces.Items {
+		namespace := workspace.Status.Namespace
+		if len(namespace) == 0 {
+			namespace = workspace.Namespace
+		}
+
+		for _, route := range workspace.Status.Routes {
+			targets[route.Host] = append(targets[route.Host], target{
+				workspace: types.NamespacedName{Namespace: workspace.Namespace, Name: workspace.Name},
+				path:      route.Path,
+				address:   fmt.Sprintf("%s.%s.svc.cluster.local:%d", route.Service, namespace, route.Port),
+			})
+		}
+	}
+
+	return targets, nil
+}
+
+func (p *Proxy) match(host, path string) *target {
+	var matched *target
+	for i, t := range p.targets[host] {
+		if !strings.HasPrefix(path, t.path) {
+			continue
+		}
+
+		if matched == nil || len(t.path) > len(matched.path) {
+			matched = &p.targets[host][i]
+		}
+	}
+
+	return matched
+}
+
+func reachable(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+	return true
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
@@ -41,6 +43,11 @@ func (w *Workspace) ServeHTTP(response http.ResponseWriter, request *http.Reques
 
 	if err != nil {
 		fmt.Println("Error trying to get the list of workspaces: ", err)
+		return
+	}
+
+	if err := w.recordActivity(workspace); err != nil {
+		fmt.Println("Error trying to record the activity of the workspace: ", err)
 	}
 
 	fmt.Printf("Workspaces: %+v\n", workspace)
@@ -84,3 +91,23 @@ func (w *Workspace) createWorkspace(project *spot.Project, name string) (*spot.W
 
 	return &workspace, err
 }
+
+// recordActivity stamps the workspace with the time of the webhook
+// which pushes back the moment the workspace expires.
+func (w *Workspace) recordActivity(workspace *spot.Workspace) error {
+	return annotate(context.TODO(), w.Client, workspace.Namespace, workspace.Name, spot.LastActivityAnnotation, time.Now())
+}
+
+// annotate sets the annotation to the timestamp on the workspace.
+func annotate(ctx context.Context, client rest.Interface, namespace, name, annotation string, timestamp time.Time) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, annotation, timestamp.UTC().Format(time.RFC3339))
+
+	return client.
+		Patch(types.MergePatchType).
+		Resource("workspaces").
+		Namespace(namespace).
+		Name(name).
+		Body([]byte(patch)).
+		Do(ctx).
+		Error()
+}